@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// command is an administrative task run from the command line instead of
+// the web server, e.g. "insta recount"
+type command struct {
+	usage string
+	run   func(st *Stores, args []string) error
+}
+
+var commands = map[string]command{
+	"migratekeys": {"migratekeys", migrateKeys},
+	"recount":     {"recount [userid...]", recount},
+	"runjobs":     {"runjobs", runJobs},
+	"sweep":       {"sweep", sweep},
+}
+
+// runCommand runs the command named by args[0]
+func runCommand(st *Stores, args []string) error {
+
+	cmd, ok := commands[args[0]]
+
+	if !ok {
+		usage := []string{}
+		for _, c := range commands {
+			usage = append(usage, "  "+c.usage)
+		}
+		sort.Strings(usage)
+		return fmt.Errorf("unknown command %q, available commands:\n%s", args[0], strings.Join(usage, "\n"))
+	}
+
+	return cmd.run(st, args[1:])
+}
+
+// recount recomputes PhotoCount, FollowerCount and FollowingCount of the
+// given users, or of all users, from the photo and follower records
+func recount(st *Stores, ids []string) error {
+
+	if len(ids) > 0 {
+		for _, id := range ids {
+			if err := recountUser(st, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var start pageKey
+	n := 0
+
+	for {
+		users, next, err := st.Users.List(start, maxPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			if err := recountUser(st, u.ID); err != nil {
+				return err
+			}
+			n++
+		}
+
+		if next == nil {
+			break
+		}
+		start = next
+	}
+
+	log.Infof("Recounted %d users", n)
+
+	return nil
+}
+
+func recountUser(st *Stores, id string) error {
+
+	photos, err := st.Photos.CountByUser(id)
+
+	if err != nil {
+		return err
+	}
+
+	followers, err := st.Followers.CountFollowers(id)
+
+	if err != nil {
+		return err
+	}
+
+	following, err := st.Followers.CountFollowing(id)
+
+	if err != nil {
+		return err
+	}
+
+	log.Infof("User %s: %d photos, %d followers, %d following", id, photos, followers, following)
+
+	return st.Users.SetCounts(id, photos, followers, following)
+}
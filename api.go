@@ -0,0 +1,799 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// apiUser is the JSON representation of a user
+type apiUser struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	FullName   string `json:"fullName"`
+	PhotoCount uint   `json:"photoCount"`
+	Followers  uint   `json:"followers"`
+	Following  uint   `json:"following"`
+	Private    bool   `json:"private"`
+}
+
+// apiUserRef is the short JSON representation of a user in lists
+type apiUserRef struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	FullName string `json:"fullName"`
+}
+
+// apiPhoto is the JSON representation of a photo
+type apiPhoto struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"userId"`
+	Caption      string     `json:"caption"`
+	URL          string     `json:"url"`
+	ThumbnailURL string     `json:"thumbnailUrl"`
+	Media        []apiMedia `json:"media"`
+	Likes        uint       `json:"likes"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	DeletedAt    *time.Time `json:"deletedAt,omitempty"`
+	Version      uint       `json:"version"`
+	EditedAt     *time.Time `json:"editedAt,omitempty"`
+}
+
+// apiMedia is one image or video of a post. Videos have their poster as
+// thumbnail.
+type apiMedia struct {
+	Type           string  `json:"type"`
+	URL            string  `json:"url"`
+	ThumbnailURL   string  `json:"thumbnailUrl,omitempty"` // missing when ThumbnailError says why
+	ThumbnailError string  `json:"thumbnailError,omitempty"`
+	Format         string  `json:"format,omitempty"`
+	Codec          string  `json:"codec,omitempty"`
+	Duration       float64 `json:"duration,omitempty"` // seconds
+}
+
+// apiCaptionEdit is the JSON representation of an earlier caption
+type apiCaptionEdit struct {
+	Version  uint      `json:"version"`
+	Caption  string    `json:"caption"`
+	EditorID string    `json:"editorId"`
+	EditedAt time.Time `json:"editedAt"`
+}
+
+// apiComment is the JSON representation of a comment
+type apiComment struct {
+	UserID    string    `json:"userId"`
+	Username  string    `json:"username"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// apiErrorBody is the envelope of every API error response
+type apiErrorBody struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// registerAPIRoutes adds the versioned JSON API to r
+func registerAPIRoutes(r *gin.Engine) {
+
+	auth := r.Group("/api/v1/auth")
+	{
+		auth.POST("/token", apiSignIn)
+		auth.POST("/refresh", apiRefresh)
+	}
+
+	v1 := r.Group("/api/v1", APIAuthRequired())
+	{
+		v1.GET("/me", apiMe)
+		v1.PATCH("/me", apiUpdateMe)
+		v1.GET("/me/requests", apiListRequests)
+		v1.GET("/me/blocked", apiListRelation(func(st *Stores) RelationStore { return st.Blocks }))
+		v1.GET("/me/muted", apiListRelation(func(st *Stores) RelationStore { return st.Mutes }))
+		v1.GET("/me/deleted", apiListTrashed)
+		v1.POST("/me/requests/:id", apiAnswerRequest(approveFollowRequest))
+		v1.DELETE("/me/requests/:id", apiAnswerRequest(rejectFollowRequest))
+
+		v1.GET("/users/:username", apiGetUser)
+		v1.GET("/users/:username/photos", apiGetUserPhotos)
+		v1.GET("/users/:username/followers", apiFollowList(followersPage))
+		v1.GET("/users/:username/following", apiFollowList(followingPage))
+		v1.POST("/users/:id/follow", authorizeUser(canFollow), apiFollow)
+		v1.DELETE("/users/:id/follow", authorizeUser(notSelf), apiUnfollow)
+		v1.POST("/users/:id/block", authorizeUser(notSelf), apiRelation(blockUser))
+		v1.DELETE("/users/:id/block", authorizeUser(notSelf), apiRelation(unblockUser))
+		v1.POST("/users/:id/mute", authorizeUser(notSelf), apiRelation(muteUser))
+		v1.DELETE("/users/:id/mute", authorizeUser(notSelf), apiRelation(unmuteUser))
+
+		v1.GET("/feed", apiFeed)
+		v1.GET("/photos", apiListPhotos)
+		v1.POST("/photos", apiCreatePhoto)
+		v1.GET("/photos/:id", authorizePhoto(canViewPhoto), apiGetPhoto)
+		v1.PATCH("/photos/:id", authorizePhoto(canEditPhoto), apiEditPhoto)
+		v1.GET("/photos/:id/edits", authorizePhoto(canViewPhoto), apiListEdits)
+		v1.DELETE("/photos/:id", authorizePhoto(canDeletePhoto), apiDeletePhoto)
+		v1.POST("/photos/:id/restore", authorizePhoto(canRestorePhoto), apiRestorePhoto)
+		v1.GET("/photos/:id/likes", authorizePhoto(canViewPhoto), apiListLikes)
+		v1.POST("/photos/:id/likes", authorizePhoto(canInteractWithPhoto), apiLikePhoto)
+		v1.DELETE("/photos/:id/likes", authorizePhoto(canViewPhoto), apiUnlikePhoto)
+		v1.GET("/photos/:id/comments", authorizePhoto(canViewPhoto), apiListComments)
+		v1.POST("/photos/:id/comments", authorizePhoto(canInteractWithPhoto), apiCreateComment)
+	}
+}
+
+// apiError aborts the request with the API error envelope
+func apiError(c *gin.Context, status int, message string) {
+	body := apiErrorBody{}
+	body.Error.Status = status
+	body.Error.Message = message
+	c.AbortWithStatusJSON(status, body)
+}
+
+// apiStoreError maps a store error to a 403, 404, 409 or 500 response
+func apiStoreError(c *gin.Context, err error, what string) {
+	if err == errBlocked {
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err == errSelf {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err == errConflict {
+		apiError(c, http.StatusConflict, what+" was changed by someone else, reload it and try again")
+		return
+	}
+	if err == errNotFound {
+		apiError(c, http.StatusNotFound, what+" not found")
+		return
+	}
+	log.Errorf("API error loading %s: %v", what, err)
+	apiError(c, http.StatusInternalServerError, "Internal server error")
+}
+
+// apiCursor decodes the 'cursor' query parameter, responding with 400 when
+// it is invalid
+func apiCursor(c *gin.Context) (pageKey, bool) {
+	start, err := decodeCursor(c.Query("cursor"))
+
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	return start, true
+}
+
+func newAPIUser(u *user) apiUser {
+	return apiUser{
+		ID:         u.ID,
+		Username:   u.Username,
+		FullName:   u.FullName,
+		PhotoCount: u.PhotoCount,
+		Followers:  u.FollowerCount,
+		Following:  u.FollowingCount,
+		Private:    u.Private,
+	}
+}
+
+func newAPIUserRefs(users []user) []apiUserRef {
+	out := make([]apiUserRef, 0, len(users))
+	for _, u := range users {
+		out = append(out, apiUserRef{u.ID, u.Username, u.FullName})
+	}
+	return out
+}
+
+func newAPIPhoto(st *Stores, p *photo) apiPhoto {
+
+	media := []apiMedia{}
+	for _, item := range p.Items() {
+		kind := "image"
+		if item.IsVideo() {
+			kind = videoItem
+		}
+
+		m := apiMedia{
+			Type:           kind,
+			URL:            st.Objects.URL(item.Key()),
+			ThumbnailError: item.ThumbnailError,
+			Format:         item.Format,
+			Codec:          item.Codec,
+			Duration:       item.Duration.Seconds(),
+		}
+
+		if item.ThumbnailError == "" {
+			m.ThumbnailURL = st.Objects.URL(item.ThumbKey())
+		}
+
+		media = append(media, m)
+	}
+
+	return apiPhoto{
+		ID:           p.ID,
+		UserID:       p.UserID,
+		Caption:      p.Caption,
+		URL:          st.Objects.URL(p.Key()),
+		ThumbnailURL: st.Objects.URL(p.ThumbKey()),
+		Media:        media,
+		Likes:        p.Likes,
+		CreatedAt:    p.CreatedAt,
+		DeletedAt:    p.DeletedAt,
+		Version:      p.Version,
+		EditedAt:     p.EditedAt,
+	}
+}
+
+func newAPIPhotos(st *Stores, photos []photo) []apiPhoto {
+	out := make([]apiPhoto, 0, len(photos))
+	for i := range photos {
+		out = append(out, newAPIPhoto(st, &photos[i]))
+	}
+	return out
+}
+
+func newAPIComment(users *userLoader, cm *comment) apiComment {
+	return apiComment{
+		UserID:    cm.UserID,
+		Username:  users.Username(cm.UserID),
+		Text:      cm.Text,
+		CreatedAt: cm.CreatedAt,
+	}
+}
+
+// apiTokens is the JSON representation of issued tokens
+type apiTokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+}
+
+// POST /api/v1/auth/token with {"username": "...", "password": "..."}
+func apiSignIn(c *gin.Context) {
+	var body struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Username == "" {
+		apiError(c, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	tokens, err := identityFrom(c).SignIn(body.Username, body.Password)
+
+	if err != nil {
+		apiError(c, http.StatusUnauthorized, authErrorMessage(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, apiTokens{tokens.AccessToken, tokens.RefreshToken, "Bearer"})
+}
+
+// POST /api/v1/auth/refresh with {"refreshToken": "..."}
+func apiRefresh(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+		apiError(c, http.StatusBadRequest, "refreshToken is required")
+		return
+	}
+
+	tokens, err := identityFrom(c).RefreshToken(body.RefreshToken)
+
+	if err != nil {
+		apiError(c, http.StatusUnauthorized, authErrorMessage(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, apiTokens{tokens.AccessToken, tokens.RefreshToken, "Bearer"})
+}
+
+// GET /api/v1/me
+func apiMe(c *gin.Context) {
+	c.JSON(http.StatusOK, newAPIUser(currentUser(c)))
+}
+
+// PATCH /api/v1/me with {"private": true}
+func apiUpdateMe(c *gin.Context) {
+	st := storesFrom(c)
+
+	var body struct {
+		Private *bool `json:"private"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		apiError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if body.Private != nil {
+		if err := setPrivate(st, currentUserID(c), *body.Private); err != nil {
+			apiStoreError(c, err, "User")
+			return
+		}
+	}
+
+	u, err := st.Users.FindByID(currentUserID(c))
+
+	if err != nil {
+		apiStoreError(c, err, "User")
+		return
+	}
+
+	c.JSON(http.StatusOK, newAPIUser(u))
+}
+
+// GET /api/v1/me/requests?cursor=&limit=
+func apiListRequests(c *gin.Context) {
+	st := storesFrom(c)
+
+	start, ok := apiCursor(c)
+
+	if !ok {
+		return
+	}
+
+	users, next, err := requestsPage(st, currentUserID(c), start, pageSize(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Follow requests")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": newAPIUserRefs(users), "next": encodeCursor(next)})
+}
+
+// GET /api/v1/me/deleted?cursor=&limit=
+func apiListTrashed(c *gin.Context) {
+	st := storesFrom(c)
+
+	start, ok := apiCursor(c)
+
+	if !ok {
+		return
+	}
+
+	photos, next, err := st.Photos.Trashed(currentUserID(c), start, pageSize(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Photos")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"photos": newAPIPhotos(st, photos), "next": encodeCursor(next)})
+}
+
+// POST /api/v1/me/requests/:id approves, DELETE rejects
+func apiAnswerRequest(answer func(st *Stores, userid string, followerid string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := answer(storesFrom(c), currentUserID(c), c.Param("id")); err != nil {
+			apiStoreError(c, err, "Follow request")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GET /api/v1/me/blocked?cursor=&limit=
+// GET /api/v1/me/muted?cursor=&limit=
+func apiListRelation(store func(st *Stores) RelationStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := storesFrom(c)
+
+		start, ok := apiCursor(c)
+
+		if !ok {
+			return
+		}
+
+		users, next, err := relationPage(st, store(st), currentUserID(c), start, pageSize(c))
+
+		if err != nil {
+			apiStoreError(c, err, "Users")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"users": newAPIUserRefs(users), "next": encodeCursor(next)})
+	}
+}
+
+// POST and DELETE /api/v1/users/:id/block and /api/v1/users/:id/mute
+func apiRelation(change func(st *Stores, userid string, otherid string) error) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := storesFrom(c)
+
+		if err := change(st, currentUserID(c), c.Param("id")); err != nil {
+			apiStoreError(c, err, "User")
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GET /api/v1/users/:username
+func apiGetUser(c *gin.Context) {
+	st := storesFrom(c)
+
+	u, err := st.Users.FindByUsername(c.Param("username"))
+
+	if err != nil {
+		apiStoreError(c, err, "User")
+		return
+	}
+
+	c.JSON(http.StatusOK, newAPIUser(u))
+}
+
+// GET /api/v1/users/:username/photos?cursor=&limit=
+func apiGetUserPhotos(c *gin.Context) {
+	st := storesFrom(c)
+
+	u, err := st.Users.FindByUsername(c.Param("username"))
+
+	if err != nil {
+		apiStoreError(c, err, "User")
+		return
+	}
+
+	if ok, err := canSeePhotos(st, currentUserID(c), u); !ok || err != nil {
+		apiError(c, http.StatusForbidden, "This account is private")
+		return
+	}
+
+	start, ok := apiCursor(c)
+
+	if !ok {
+		return
+	}
+
+	photos, next, err := st.Photos.ByUser(u.ID, start, pageSize(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Photos")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"photos": newAPIPhotos(st, photos), "next": encodeCursor(next)})
+}
+
+// GET /api/v1/users/:username/followers?cursor=&limit=
+// GET /api/v1/users/:username/following?cursor=&limit=
+func apiFollowList(page followPage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := storesFrom(c)
+
+		u, err := st.Users.FindByUsername(c.Param("username"))
+
+		if err != nil {
+			apiStoreError(c, err, "User")
+			return
+		}
+
+		if ok, err := canSeePhotos(st, currentUserID(c), u); !ok || err != nil {
+			apiError(c, http.StatusForbidden, "This account is private")
+			return
+		}
+
+		start, ok := apiCursor(c)
+
+		if !ok {
+			return
+		}
+
+		users, next, err := page(st, u.ID, start, pageSize(c))
+
+		if err != nil {
+			apiStoreError(c, err, "Users")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"users": newAPIUserRefs(users), "next": encodeCursor(next)})
+	}
+}
+
+// POST /api/v1/users/:id/follow
+func apiFollow(c *gin.Context) {
+	st := storesFrom(c)
+
+	requested, err := followUser(st, c.Param("id"), currentUserID(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Follower")
+		return
+	}
+
+	if requested {
+		c.JSON(http.StatusAccepted, gin.H{"requested": true})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DELETE /api/v1/users/:id/follow
+func apiUnfollow(c *gin.Context) {
+	st := storesFrom(c)
+
+	if err := unfollowUser(st, c.Param("id"), currentUserID(c)); err != nil {
+		apiStoreError(c, err, "Follower")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GET /api/v1/feed?cursor=&limit=
+func apiFeed(c *gin.Context) {
+	st := storesFrom(c)
+
+	page, err := loadFeed(st, currentUserID(c), c.Query("cursor"), pageSize(c))
+
+	if err == errBadCursor {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err != nil {
+		apiStoreError(c, err, "Feed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"photos": newAPIPhotos(st, page.Photos), "next": page.Next})
+}
+
+// GET /api/v1/photos?cursor=&limit=
+func apiListPhotos(c *gin.Context) {
+	st := storesFrom(c)
+
+	start, ok := apiCursor(c)
+
+	if !ok {
+		return
+	}
+
+	photos, next, err := st.Photos.List(start, pageSize(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Photos")
+		return
+	}
+
+	photos = visiblePhotos(st, usersFrom(c), currentUserID(c), photos)
+
+	c.JSON(http.StatusOK, gin.H{"photos": newAPIPhotos(st, photos), "next": encodeCursor(next)})
+}
+
+// POST /api/v1/photos (multipart form with up to maxPostItems 'photofile'
+// parts and a 'caption')
+func apiCreatePhoto(c *gin.Context) {
+	st := storesFrom(c)
+
+	limitUpload(c)
+
+	form, err := c.MultipartForm()
+
+	if err != nil && formStatus(err) == http.StatusRequestEntityTooLarge {
+		apiError(c, http.StatusRequestEntityTooLarge, "The upload is too large")
+		return
+	}
+
+	if err != nil || len(form.File["photofile"]) == 0 {
+		apiError(c, http.StatusBadRequest, "photofile is required")
+		return
+	}
+
+	id, err := savePhoto(st, currentUserID(c), form.File["photofile"], c.PostForm("caption"))
+
+	if err != nil {
+		status := uploadStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Errorf("API error saving photo: %v", err)
+			apiError(c, status, "Internal server error")
+			return
+		}
+		apiError(c, status, err.Error())
+		return
+	}
+
+	p, err := st.Photos.Get(id)
+
+	if err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAPIPhoto(st, p))
+}
+
+// GET /api/v1/photos/:id
+func apiGetPhoto(c *gin.Context) {
+	c.JSON(http.StatusOK, newAPIPhoto(storesFrom(c), authorizedPhoto(c)))
+}
+
+// PATCH /api/v1/photos/:id with {"caption": "...", "version": 0}
+func apiEditPhoto(c *gin.Context) {
+	st := storesFrom(c)
+
+	var body editRequest
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Caption == nil || body.Version == nil {
+		apiError(c, http.StatusBadRequest, "caption and version are required")
+		return
+	}
+
+	p, err := editCaption(st, authorizedPhoto(c), *body.Version, *body.Caption, currentUserID(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, newAPIPhoto(st, p))
+}
+
+// GET /api/v1/photos/:id/edits
+func apiListEdits(c *gin.Context) {
+
+	edits, err := storesFrom(c).Edits.ByPhoto(authorizedPhoto(c).ID)
+
+	if err != nil {
+		apiStoreError(c, err, "Edits")
+		return
+	}
+
+	out := make([]apiCaptionEdit, 0, len(edits))
+	for _, e := range edits {
+		out = append(out, apiCaptionEdit{e.Version, e.Caption, e.EditorID, e.EditedAt})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"edits": out})
+}
+
+// DELETE /api/v1/photos/:id
+func apiDeletePhoto(c *gin.Context) {
+	st := storesFrom(c)
+
+	if err := trashPhoto(st, authorizedPhoto(c).ID); err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// POST /api/v1/photos/:id/restore
+func apiRestorePhoto(c *gin.Context) {
+	st := storesFrom(c)
+	p := authorizedPhoto(c)
+
+	if err := restorePhoto(st, p); err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	p, err := st.Photos.Get(p.ID)
+
+	if err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, newAPIPhoto(st, p))
+}
+
+// GET /api/v1/photos/:id/likes?cursor=&limit=
+func apiListLikes(c *gin.Context) {
+	st := storesFrom(c)
+	id := authorizedPhoto(c).ID
+
+	start, ok := apiCursor(c)
+
+	if !ok {
+		return
+	}
+
+	users, next, err := likers(st, id, start, pageSize(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Likes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": newAPIUserRefs(users), "next": encodeCursor(next)})
+}
+
+// POST /api/v1/photos/:id/likes
+func apiLikePhoto(c *gin.Context) {
+	st := storesFrom(c)
+
+	likes, err := likePhoto(st, c.Param("id"), currentUserID(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"likes": likes, "liked": true})
+}
+
+// DELETE /api/v1/photos/:id/likes
+func apiUnlikePhoto(c *gin.Context) {
+	st := storesFrom(c)
+
+	likes, err := unlikePhoto(st, c.Param("id"), currentUserID(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"likes": likes, "liked": false})
+}
+
+// GET /api/v1/photos/:id/comments?cursor=&limit=
+func apiListComments(c *gin.Context) {
+	st := storesFrom(c)
+
+	start, ok := apiCursor(c)
+
+	if !ok {
+		return
+	}
+
+	comments, next, err := st.Comments.ByPhoto(c.Param("id"), start, pageSize(c))
+
+	if err != nil {
+		apiStoreError(c, err, "Comments")
+		return
+	}
+
+	users := usersFrom(c)
+
+	ids := make([]string, 0, len(comments))
+	for _, cm := range comments {
+		ids = append(ids, cm.UserID)
+	}
+
+	if err := users.Prime(ids...); err != nil {
+		apiStoreError(c, err, "Users")
+		return
+	}
+
+	out := make([]apiComment, 0, len(comments))
+	for i := range comments {
+		out = append(out, newAPIComment(users, &comments[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"comments": out, "next": encodeCursor(next)})
+}
+
+// POST /api/v1/photos/:id/comments with {"comment": "..."}
+func apiCreateComment(c *gin.Context) {
+	st := storesFrom(c)
+
+	var body struct {
+		Comment string `json:"comment"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Comment == "" {
+		apiError(c, http.StatusBadRequest, "comment is required")
+		return
+	}
+
+	cm, err := insertComment(st, authorizedPhoto(c).ID, currentUserID(c), body.Comment)
+
+	if err != nil {
+		apiStoreError(c, err, "Comment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAPIComment(usersFrom(c), cm))
+}
@@ -1,44 +1,152 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
+const subKey = "sub"
+const currentUserKey = "currentUser"
+
 // AuthRequired an authentication middleware. If the JWT token is invalid, the
 // user is redirected to /signup.
 func AuthRequired() gin.HandlerFunc {
+	return authenticate(func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/signup")
+		c.Abort()
+	})
+}
+
+// APIAuthRequired an authentication middleware for the JSON API. If the JWT
+// token is invalid, a 401 error is returned.
+func APIAuthRequired() gin.HandlerFunc {
+	return authenticate(func(c *gin.Context) {
+		c.Header("WWW-Authenticate", `Bearer realm="api"`)
+		apiError(c, http.StatusUnauthorized, "Authentication required")
+	})
+}
+
+// authenticate validates the access token sent as 'Authorization: Bearer'
+// header or, failing that, kept in the cookie session. On success the 'sub'
+// claim and the user record are stored in the context, otherwise deny is
+// called.
+func authenticate(deny gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		log.Debug("AuthRequired()")
 
-		s := sessions.Default(c)
-		jwt := s.Get(accessToken)
+		idp := identityFrom(c)
 
-		if jwt == nil {
-			log.Error("Access token not found in session")
-			c.Redirect(http.StatusFound, "/signup")
-			return
-		}
+		var sub string
+		var err error
+
+		if jwt := bearerToken(c); jwt != "" {
+			sub, err = idp.ValidateToken(jwt)
+		} else {
+			s := sessions.Default(c)
+			jwt := s.Get(accessToken)
+
+			if jwt == nil {
+				log.Error("Access token not found in session")
+				deny(c)
+				return
+			}
 
-		cog := NewCognito()
-		sub, err := cog.ValidateToken(jwt.(string))
+			sub, err = idp.ValidateToken(jwt.(string))
+
+			if err != nil {
+				sub, err = refreshSession(s, idp)
+			}
+		}
 
 		if err != nil {
 			log.Error("Error validating token: ", err)
-			c.Redirect(http.StatusFound, "/signup")
+			deny(c)
 			return
 		}
 
 		if sub == "" {
 			log.Error("sub not found: ", err)
-			c.Redirect(http.StatusFound, "/signup")
+			deny(c)
 			return
 		}
 
+		u, err := usersFrom(c).Load(sub)
+
+		if err != nil {
+			log.Error("Could not find user: ", err)
+			deny(c)
+			return
+		}
+
+		c.Set(subKey, sub)
+		c.Set(currentUserKey, u)
+
 		c.Next()
 	}
 }
+
+// bearerToken returns the token of an 'Authorization: Bearer' header
+func bearerToken(c *gin.Context) string {
+	h := c.GetHeader("Authorization")
+
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+
+	return ""
+}
+
+// refreshSession replaces an expired access token using the refresh token kept
+// in the session. Returns the 'sub' claim of the new access token.
+func refreshSession(s sessions.Session, idp IdentityProvider) (string, error) {
+
+	rt, ok := s.Get(refreshToken).(string)
+
+	if !ok || rt == "" {
+		return "", errors.New("refresh token not found in session")
+	}
+
+	tokens, err := idp.RefreshToken(rt)
+
+	if err != nil {
+		return "", err
+	}
+
+	sub, err := idp.ValidateToken(tokens.AccessToken)
+
+	if err != nil {
+		return "", err
+	}
+
+	log.Debug("Refreshed access token for: ", sub)
+
+	saveTokens(s, sub, tokens)
+
+	return sub, nil
+}
+
+// saveTokens stores the tokens and user ID in the cookie session
+func saveTokens(s sessions.Session, sub string, tokens *Tokens) {
+	s.Set(userKey, sub)
+	s.Set(accessToken, tokens.AccessToken)
+	s.Set(refreshToken, tokens.RefreshToken)
+	s.Save()
+}
+
+// currentUserID returns the ID of the user authenticated by AuthRequired
+func currentUserID(c *gin.Context) string {
+	return c.GetString(subKey)
+}
+
+// currentUser returns the user authenticated by AuthRequired
+func currentUser(c *gin.Context) *user {
+	u, _ := c.Get(currentUserKey)
+	cu, _ := u.(*user)
+	return cu
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// errBlocked is returned when one of the users involved blocked the other
+var errBlocked = errors.New("This user is not available")
+
+// relation is a block or mute created by UserID against OtherID
+type relation struct {
+	UserID    string
+	OtherID   string
+	CreatedAt time.Time
+}
+
+// isBlocked reports whether either user blocked the other
+func isBlocked(st *Stores, userid string, otherid string) (bool, error) {
+
+	blocked, err := st.Blocks.Exists(userid, otherid)
+
+	if err != nil || blocked {
+		return blocked, err
+	}
+
+	return st.Blocks.Exists(otherid, userid)
+}
+
+// blockUser blocks otherid for userid and removes the follows between them
+func blockUser(st *Stores, userid string, otherid string) error {
+
+	if userid == otherid {
+		return errSelf
+	}
+
+	err := st.Blocks.Put(&relation{
+		UserID:    userid,
+		OtherID:   otherid,
+		CreatedAt: time.Now(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := unfollowUser(st, userid, otherid); err != nil {
+		return err
+	}
+
+	return unfollowUser(st, otherid, userid)
+}
+
+func unblockUser(st *Stores, userid string, otherid string) error {
+	return st.Blocks.Delete(userid, otherid)
+}
+
+// muteUser hides the photos of otherid from the feed of userid
+func muteUser(st *Stores, userid string, otherid string) error {
+
+	if userid == otherid {
+		return errSelf
+	}
+
+	return st.Mutes.Put(&relation{
+		UserID:    userid,
+		OtherID:   otherid,
+		CreatedAt: time.Now(),
+	})
+}
+
+func unmuteUser(st *Stores, userid string, otherid string) error {
+	return st.Mutes.Delete(userid, otherid)
+}
+
+// withoutMuted drops the photos of the users userid muted
+func withoutMuted(st *Stores, userid string, photos []photo) ([]photo, error) {
+
+	muted, err := st.Mutes.Others(userid)
+
+	if err != nil || len(muted) == 0 {
+		return photos, err
+	}
+
+	skip := map[string]bool{}
+	for _, id := range muted {
+		skip[id] = true
+	}
+
+	kept := []photo{}
+	for _, p := range photos {
+		if !skip[p.UserID] {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept, nil
+}
+
+// relationPage returns a page of the users in a block or mute list
+func relationPage(st *Stores, rs RelationStore, userid string, start pageKey, limit int) ([]user, pageKey, error) {
+
+	ids, next, err := rs.Page(userid, start, limit)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users, err := st.Users.FindMany(ids)
+
+	return users, next, err
+}
+
+// Block blocks a user
+// POST /user/:id/block
+func Block(c *gin.Context) {
+	changeRelation(c, blockUser)
+}
+
+// Unblock unblocks a user
+// POST /user/:id/unblock
+func Unblock(c *gin.Context) {
+	changeRelation(c, unblockUser)
+}
+
+// Mute mutes a user
+// POST /user/:id/mute
+func Mute(c *gin.Context) {
+	changeRelation(c, muteUser)
+}
+
+// Unmute unmutes a user
+// POST /user/:id/unmute
+func Unmute(c *gin.Context) {
+	changeRelation(c, unmuteUser)
+}
+
+// changeRelation applies change between the current user and the user
+// named by the 'id' parameter, answering 404 for unknown users and 400 for
+// the current user
+func changeRelation(c *gin.Context, change func(st *Stores, userid string, otherid string) error) {
+
+	id := c.Params.ByName("id")
+
+	err := change(storesFrom(c), currentUserID(c), id)
+
+	switch err {
+	case nil:
+		c.JSON(http.StatusOK, nil)
+	case errNotFound:
+		c.JSON(http.StatusNotFound, nil)
+	case errSelf:
+		c.JSON(http.StatusBadRequest, nil)
+	default:
+		log.Errorf("failed to update relation, %v", err)
+		c.JSON(http.StatusInternalServerError, nil)
+	}
+}
+
+// BlockedSettings lists the blocked and muted users, each paginated with its
+// own cursor in the 'blocked' and 'muted' parameters
+// GET /settings/blocked
+func BlockedSettings(c *gin.Context) {
+
+	st := storesFrom(c)
+	user := currentUser(c)
+
+	blockedStart, err := decodeCursor(c.Query("blocked"))
+
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
+	}
+
+	mutedStart, err := decodeCursor(c.Query("muted"))
+
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
+	}
+
+	blocked, nextBlocked, err := relationPage(st, st.Blocks, user.ID, blockedStart, pageSize(c))
+
+	if err != nil {
+		log.Errorf("Error loading blocked users: %v", err)
+	}
+
+	muted, nextMuted, err := relationPage(st, st.Mutes, user.ID, mutedStart, pageSize(c))
+
+	if err != nil {
+		log.Errorf("Error loading muted users: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "blocked.html", gin.H{
+		"title":       "Blocked and muted",
+		"user":        user,
+		"blocked":     blocked,
+		"muted":       muted,
+		"nextBlocked": encodeCursor(nextBlocked),
+		"nextMuted":   encodeCursor(nextMuted),
+		"CurrentUser": user,
+	})
+}
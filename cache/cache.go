@@ -0,0 +1,21 @@
+// Package cache provides the key/value caches used in front of the stores,
+// either in process or in a shared Redis server.
+package cache
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMiss is returned when a key is not cached or has expired.
+var ErrMiss = errors.New("Cache miss")
+
+// Cache stores opaque values by key with a time to live.
+type Cache interface {
+	// Get returns the cached value or ErrMiss.
+	Get(key string) ([]byte, error)
+	// Set stores value under key for ttl. A zero ttl never expires.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys. Deleting a missing key is not an error.
+	Delete(keys ...string) error
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// LRU is an in-process Cache that evicts the least recently used entries
+// beyond a fixed size. It is not shared between instances.
+type LRU struct {
+	entries *lru.Cache
+}
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU creates a cache holding at most size entries
+func NewLRU(size int) (*LRU, error) {
+
+	entries, err := lru.New(size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &LRU{entries: entries}, nil
+}
+
+func (c *LRU) Get(key string) ([]byte, error) {
+
+	v, ok := c.entries.Get(key)
+
+	if !ok {
+		return nil, ErrMiss
+	}
+
+	e := v.(entry)
+
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.entries.Remove(key)
+		return nil, ErrMiss
+	}
+
+	return e.value, nil
+}
+
+func (c *LRU) Set(key string, value []byte, ttl time.Duration) error {
+
+	e := entry{value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	c.entries.Add(key, e)
+
+	return nil
+}
+
+func (c *LRU) Delete(keys ...string) error {
+	for _, key := range keys {
+		c.entries.Remove(key)
+	}
+	return nil
+}
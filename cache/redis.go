@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Redis is a Cache shared by all instances through a server speaking the
+// Redis protocol.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to the server at addr, e.g. "localhost:6379"
+func NewRedis(addr string, password string, db int) *Redis {
+	return &Redis{
+		client: redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: password,
+			DB:       db,
+		}),
+	}
+}
+
+func (c *Redis) Get(key string) ([]byte, error) {
+
+	value, err := c.client.Get(key).Bytes()
+
+	if err == redis.Nil {
+		return nil, ErrMiss
+	}
+
+	return value, err
+}
+
+func (c *Redis) Set(key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(key, value, ttl).Err()
+}
+
+func (c *Redis) Delete(keys ...string) error {
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return c.client.Del(keys...).Err()
+}
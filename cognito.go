@@ -29,12 +29,7 @@ func init() {
 
 	log.Info("Initializing Cognito")
 
-	log.Info("Loading configuration")
-	viper.SetConfigName("config") // config.toml
-	viper.AddConfigPath(".")      // use working directory
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Errorf("error reading config file, %v", err)
+	if !configLoaded {
 		return
 	}
 
@@ -76,8 +71,8 @@ func NewCognito() *Cognito {
 }
 
 // SignUp creates a new Cognito user in the user pool, setting its status
-// to CONFIRMED. Returns the authenticated user's JWT access token.
-func (c *Cognito) SignUp(username string, password string, email string, fullName string) (string, error) {
+// to CONFIRMED. Returns the authenticated user's JWT tokens.
+func (c *Cognito) SignUp(username string, password string, email string, fullName string) (*Tokens, error) {
 
 	log.Info("AdminCreateUser: ", username)
 
@@ -104,7 +99,7 @@ func (c *Cognito) SignUp(username string, password string, email string, fullNam
 
 	if err != nil {
 		log.Error("Error: ", err.Error())
-		return "", err
+		return nil, err
 	}
 
 	// Attempt login to get session value, which is used to confirm the user
@@ -146,20 +141,18 @@ func (c *Cognito) SignUp(username string, password string, email string, fullNam
 
 	if err != nil {
 		log.Error(err.Error())
-		return "", err.(awserr.Error).OrigErr()
+		return nil, err.(awserr.Error).OrigErr()
 	}
 
 	idToken := aws.StringValue(chalresp.AuthenticationResult.IdToken)
-	accessToken := aws.StringValue(chalresp.AuthenticationResult.AccessToken)
 
 	log.Debug("ID Token: ", idToken)
-	log.Debug("AccessToken: ", accessToken)
 
-	return accessToken, nil
+	return tokens(chalresp.AuthenticationResult), nil
 }
 
-// SignIn authenticates a user and returns a JWT token
-func (c *Cognito) SignIn(username string, password string) (string, error) {
+// SignIn authenticates a user and returns its JWT tokens
+func (c *Cognito) SignIn(username string, password string) (*Tokens, error) {
 
 	aia := &cognitoidentityprovider.AdminInitiateAuthInput{
 		AuthFlow: aws.String("ADMIN_NO_SRP_AUTH"),
@@ -176,14 +169,63 @@ func (c *Cognito) SignIn(username string, password string) (string, error) {
 
 	if autherr != nil {
 		log.Error(autherr.Error())
-		return "", autherr
+		return nil, autherr
+	}
+
+	return tokens(authresp.AuthenticationResult), nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token
+func (c *Cognito) RefreshToken(refreshToken string) (*Tokens, error) {
+
+	aia := &cognitoidentityprovider.AdminInitiateAuthInput{
+		AuthFlow: aws.String("REFRESH_TOKEN_AUTH"),
+		AuthParameters: map[string]*string{
+			"REFRESH_TOKEN": aws.String(refreshToken),
+		},
+		ClientId:   aws.String(clientID),
+		UserPoolId: aws.String(userPoolID),
+	}
+
+	log.Info("AdminInitiateAuth: REFRESH_TOKEN_AUTH")
+	authresp, err := c.cip.AdminInitiateAuth(aia)
+
+	if err != nil {
+		log.Error(err.Error())
+		return nil, err
 	}
 
-	accessToken := aws.StringValue(authresp.AuthenticationResult.AccessToken)
+	t := tokens(authresp.AuthenticationResult)
+
+	// Cognito does not rotate the refresh token
+	if t.RefreshToken == "" {
+		t.RefreshToken = refreshToken
+	}
+
+	return t, nil
+}
+
+// SignOut signs the user out of all devices, invalidating its refresh tokens
+func (c *Cognito) SignOut(accessToken string) error {
+
+	_, err := c.cip.GlobalSignOut(&cognitoidentityprovider.GlobalSignOutInput{
+		AccessToken: aws.String(accessToken),
+	})
+
+	return err
+}
+
+// tokens extracts the access and refresh tokens from an auth result
+func tokens(result *cognitoidentityprovider.AuthenticationResultType) *Tokens {
+
+	t := &Tokens{
+		AccessToken:  aws.StringValue(result.AccessToken),
+		RefreshToken: aws.StringValue(result.RefreshToken),
+	}
 
-	log.Debug("AccessToken: ", accessToken)
+	log.Debug("AccessToken: ", t.AccessToken)
 
-	return accessToken, nil
+	return t
 }
 
 // ValidateToken validates a JWT token and returns the 'sub' claim.
@@ -206,7 +248,7 @@ func (c *Cognito) ValidateToken(jwtToken string) (string, error) {
 		return claims["sub"].(string), nil // Valid token
 	}
 
-	return "", nil // Invalid token
+	return "", errors.New("invalid token")
 }
 
 // getKey returns the key for validating in ValidateToken
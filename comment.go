@@ -4,10 +4,6 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
 type comment struct {
@@ -17,8 +13,9 @@ type comment struct {
 	CreatedAt time.Time
 }
 
-// insertComment inserts a comment record
-func insertComment(photoid string, userid string, text string) error {
+// insertComment inserts a comment record. Callers check
+// canInteractWithPhoto.
+func insertComment(st *Stores, photoid string, userid string, text string) (*comment, error) {
 	comment := &comment{
 		Text:      text,
 		PhotoID:   photoid,
@@ -26,67 +23,12 @@ func insertComment(photoid string, userid string, text string) error {
 		CreatedAt: time.Now(),
 	}
 
-	av, err := dynamodbattribute.MarshalMap(comment)
-
-	if err != nil {
-		log.Errorf("failed to DynamoDB marshal Record, %v", err)
-		return err
-	}
-
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	_, err = svc.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("PhotosAppComments"),
-		Item:      av,
-	})
-
-	if err != nil {
-		log.Errorf("Failed to put Record to DynamoDB, %v", err)
-		return err
-	}
-
-	log.Println("Inserted comment record")
-
-	return nil
-}
-
-// findCommentsByPhoto gets all comments for a photo
-func findCommentsByPhoto(photoid string) ([]comment, error) {
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppComments"),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"PhotoID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(photoid),
-					},
-				},
-			},
-		},
-		ScanIndexForward: aws.Bool(false), // Primary sort key CreatedAt
-	}
-
-	qo, err := svc.Query(queryInput)
-
-	if err != nil {
+	if err := st.Comments.Put(comment); err != nil {
+		log.Errorf("Failed to put comment record, %v", err)
 		return nil, err
 	}
 
-	comments := []comment{}
-	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &comments); err != nil {
-		log.Errorf("Failed to unmarshal Query result items, %v", err)
-		return nil, err
-	}
-
-	return comments, nil
-}
+	log.Println("Inserted comment record")
 
-func (c *comment) Username() string {
-	user, _ := findUserByID(c.UserID)
-	return user.Username
+	return comment, nil
 }
@@ -1,17 +1,48 @@
 #!/bin/sh
 
+# Tables created before an index was added get it with: createtables.sh update
+# Without arguments it creates the tables, failing for those that exist
+if [ "$1" = "update" ]; then
+    aws dynamodb update-table \
+        --table-name PhotosAppPhotos \
+        --attribute-definitions AttributeName=UserID,AttributeType=S AttributeName=CreatedAt,AttributeType=S \
+        --global-secondary-index-updates 'Create={IndexName=UserID-CreatedAt-index,KeySchema=[{AttributeName=UserID,KeyType=HASH},{AttributeName=CreatedAt,KeyType=RANGE}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}}'
+
+    # DynamoDB creates one index at a time
+    until aws dynamodb describe-table --table-name PhotosAppPhotos --query 'Table.GlobalSecondaryIndexes[].IndexStatus' --output text | grep -qv CREATING; do
+        sleep 10
+    done
+
+    # Sparse, only trashed photos have the Trash attribute
+    aws dynamodb update-table \
+        --table-name PhotosAppPhotos \
+        --attribute-definitions AttributeName=Trash,AttributeType=S AttributeName=DeletedAt,AttributeType=S \
+        --global-secondary-index-updates 'Create={IndexName=Trash-DeletedAt-index,KeySchema=[{AttributeName=Trash,KeyType=HASH},{AttributeName=DeletedAt,KeyType=RANGE}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}}'
+
+    exit
+fi
+
 aws dynamodb create-table \
     --table-name PhotosAppUsers \
     --attribute-definitions AttributeName=ID,AttributeType=S AttributeName=Username,AttributeType=S \
     --key-schema KeyType=HASH,AttributeName=ID KeyType=RANGE,AttributeName=Username \
     --global-secondary-indexes 'IndexName=Username-index,KeySchema=[{AttributeName=Username,KeyType=HASH}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}' \
     --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
- 
+
+# Primary keys of PhotosAppUsers by ID alone, so users can be read in batches
+aws dynamodb create-table \
+    --table-name PhotosAppUserKeys \
+    --attribute-definitions AttributeName=ID,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=ID \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
 aws dynamodb create-table \
     --table-name PhotosAppPhotos \
-    --attribute-definitions AttributeName=ID,AttributeType=S AttributeName=UserID,AttributeType=S\
+    --attribute-definitions AttributeName=ID,AttributeType=S AttributeName=UserID,AttributeType=S AttributeName=CreatedAt,AttributeType=S AttributeName=Trash,AttributeType=S AttributeName=DeletedAt,AttributeType=S \
     --key-schema KeyType=HASH,AttributeName=ID \
     --global-secondary-indexes 'IndexName=UserID-index,KeySchema=[{AttributeName=UserID,KeyType=HASH}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}' \
+        'IndexName=UserID-CreatedAt-index,KeySchema=[{AttributeName=UserID,KeyType=HASH},{AttributeName=CreatedAt,KeyType=RANGE}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}' \
+        'IndexName=Trash-DeletedAt-index,KeySchema=[{AttributeName=Trash,KeyType=HASH},{AttributeName=DeletedAt,KeyType=RANGE}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}' \
     --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
  
 aws dynamodb create-table \
@@ -26,3 +57,45 @@ aws dynamodb create-table \
     --key-schema KeyType=HASH,AttributeName=UserID KeyType=RANGE,AttributeName=FollowerID \
     --global-secondary-indexes 'IndexName=FollowerID-index,KeySchema=[{AttributeName=FollowerID,KeyType=HASH}],ProvisionedThroughput={ReadCapacityUnits=1,WriteCapacityUnits=1},Projection={ProjectionType=ALL}' \
     --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppTimeline \
+    --attribute-definitions AttributeName=UserID,AttributeType=S AttributeName=Key,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=UserID KeyType=RANGE,AttributeName=Key \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppLikes \
+    --attribute-definitions AttributeName=PhotoID,AttributeType=S AttributeName=UserID,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=PhotoID KeyType=RANGE,AttributeName=UserID \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppFollowRequests \
+    --attribute-definitions AttributeName=UserID,AttributeType=S AttributeName=FollowerID,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=UserID KeyType=RANGE,AttributeName=FollowerID \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppBlocks \
+    --attribute-definitions AttributeName=UserID,AttributeType=S AttributeName=OtherID,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=UserID KeyType=RANGE,AttributeName=OtherID \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppMutes \
+    --attribute-definitions AttributeName=UserID,AttributeType=S AttributeName=OtherID,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=UserID KeyType=RANGE,AttributeName=OtherID \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppJobs \
+    --attribute-definitions AttributeName=ID,AttributeType=S \
+    --key-schema KeyType=HASH,AttributeName=ID \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
+
+aws dynamodb create-table \
+    --table-name PhotosAppCaptionEdits \
+    --attribute-definitions AttributeName=PhotoID,AttributeType=S AttributeName=Version,AttributeType=N \
+    --key-schema KeyType=HASH,AttributeName=PhotoID KeyType=RANGE,AttributeName=Version \
+    --provisioned-throughput ReadCapacityUnits=1,WriteCapacityUnits=1
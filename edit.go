@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// captionEdit is a caption a photo had before an edit replaced it
+type captionEdit struct {
+	PhotoID  string
+	Version  uint // version of the photo that had the caption
+	Caption  string
+	EditorID string // who replaced it
+	EditedAt time.Time
+}
+
+// editRequest is the body of PATCH /photos/:id. Version is the version of
+// the photo the client edited; the edit fails if it changed since.
+type editRequest struct {
+	Caption *string `json:"caption"`
+	Version *uint   `json:"version"`
+}
+
+// editCaption replaces the caption of p if it is still at version and
+// returns the updated photo. Returns errConflict if someone else edited it
+// in the meantime.
+func editCaption(st *Stores, p *photo, version uint, caption string, editorid string) (*photo, error) {
+
+	if p.Version != version {
+		return nil, errConflict
+	}
+
+	err := st.Photos.UpdateCaption(&captionEdit{
+		PhotoID:  p.ID,
+		Version:  version,
+		Caption:  p.Caption,
+		EditorID: editorid,
+		EditedAt: time.Now().UTC(),
+	}, caption)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return st.Photos.Get(p.ID)
+}
+
+// EditPhoto changes the caption of a photo
+// PATCH /photos/:id with {"caption": "...", "version": 0}
+func EditPhoto(c *gin.Context) {
+
+	st := storesFrom(c)
+
+	var body editRequest
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.Caption == nil || body.Version == nil {
+		c.JSON(http.StatusBadRequest, nil)
+		return
+	}
+
+	p, err := editCaption(st, authorizedPhoto(c), *body.Version, *body.Caption, currentUserID(c))
+
+	if err == errConflict {
+		// Send the current caption so the client can show it
+		if p, err = st.Photos.Get(c.Param("id")); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"caption": p.Caption, "version": p.Version})
+			return
+		}
+	}
+
+	if err == errNotFound {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to edit caption, %v", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"caption": p.Caption, "version": p.Version})
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// feedPage is one page of a user's home feed
+type feedPage struct {
+	Photos []photo
+	Next   string // cursor of the following page, empty on the last page
+}
+
+// loadFeed returns the photos of the users uid follows plus its own photos,
+// newest first, starting after cursor. Photos of muted users are left out.
+func loadFeed(st *Stores, uid string, cursor string, limit int) (*feedPage, error) {
+
+	before, err := decodeFeedCursor(cursor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if timelineEnabled(st) {
+		page, err := loadTimeline(st, uid, before, limit)
+
+		if err != nil {
+			return nil, err
+		}
+
+		page.Photos, err = withoutMuted(st, uid, page.Photos)
+
+		return page, err
+	}
+
+	following, err := st.Followers.Following(uid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	muted, err := st.Mutes.Others(uid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	skip := map[string]bool{}
+	for _, id := range muted {
+		skip[id] = true
+	}
+
+	authors := []string{uid}
+	for _, id := range following {
+		if !skip[id] {
+			authors = append(authors, id)
+		}
+	}
+
+	// Each author contributes at most limit+1 photos, which is enough to fill
+	// the page and tell whether another one follows.
+	photos := []photo{}
+
+	for _, author := range authors {
+		p, err := st.Photos.ByUserBefore(author, before, limit+1)
+
+		if err != nil {
+			log.Errorf("Error loading feed photos of %s: %v", author, err)
+			continue
+		}
+
+		photos = append(photos, p...)
+	}
+
+	sort.Slice(photos, func(i, j int) bool {
+		return photos[i].CreatedAt.After(photos[j].CreatedAt)
+	})
+
+	page := &feedPage{Photos: photos}
+
+	if len(photos) > limit {
+		page.Photos = photos[:limit]
+		page.Next = encodeFeedCursor(page.Photos[limit-1].CreatedAt)
+	}
+
+	return page, nil
+}
+
+// loadTimeline reads a feed page from the precomputed timeline
+func loadTimeline(st *Stores, uid string, before time.Time, limit int) (*feedPage, error) {
+
+	entries, err := st.Timeline.Range(uid, before, limit+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &feedPage{}
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+		page.Next = encodeFeedCursor(entries[limit-1].CreatedAt)
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.PhotoID)
+	}
+
+	photos, err := st.Photos.GetMany(ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Trashed photos keep their timeline entries so restoring them is cheap
+	page.Photos = []photo{}
+	for _, p := range photos {
+		if p.DeletedAt == nil {
+			page.Photos = append(page.Photos, p)
+		}
+	}
+
+	return page, nil
+}
+
+// encodeFeedCursor encodes the creation time of the last item of a page
+func encodeFeedCursor(t time.Time) string {
+	return encodeCursor(pageKey{"CreatedAt": timestamp(t)})
+}
+
+// decodeFeedCursor decodes a cursor from encodeFeedCursor. The empty cursor
+// starts at the newest item.
+func decodeFeedCursor(cursor string) (time.Time, error) {
+
+	key, err := decodeCursor(cursor)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if key == nil {
+		return time.Now().Add(time.Minute), nil
+	}
+
+	// Also accepts cursors from before timestampLayout, without trailing zeros
+	t, err := time.Parse(time.RFC3339Nano, key["CreatedAt"])
+
+	if err != nil {
+		return time.Time{}, errBadCursor
+	}
+
+	return t, nil
+}
+
+// Feed shows the photos of the followed users
+// GET /photos/
+func Feed(c *gin.Context) {
+
+	st := storesFrom(c)
+	user := currentUser(c)
+
+	page, err := loadFeed(st, user.ID, c.Query("cursor"), pageSize(c))
+
+	if err != nil {
+		log.Errorf("Error loading feed: %v", err)
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
+	}
+
+	c.HTML(http.StatusOK, "photos.html", gin.H{
+		"title":       "Photos",
+		"user":        user,
+		"photos":      page.Photos,
+		"next":        page.Next,
+		"CurrentUser": user,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Tokens are the credentials issued by an identity provider on sign in.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// IdentityProvider authenticates users and issues the JWT access tokens
+// kept in the session.
+type IdentityProvider interface {
+	// SignUp registers a new user and signs them in.
+	SignUp(username string, password string, email string, fullName string) (*Tokens, error)
+	// SignIn authenticates a user with a password.
+	SignIn(username string, password string) (*Tokens, error)
+	// ValidateToken validates an access token and returns its 'sub' claim.
+	ValidateToken(accessToken string) (string, error)
+	// RefreshToken exchanges a refresh token for a new access token.
+	RefreshToken(refreshToken string) (*Tokens, error)
+	// SignOut invalidates the tokens issued for the session.
+	SignOut(accessToken string) error
+}
+
+const identityKey = "identity"
+const refreshToken = "refreshToken"
+
+// NewIdentityProvider creates the provider named by the 'identity.provider'
+// configuration key. Cognito is used unless "local" is configured.
+func NewIdentityProvider(users UserStore) IdentityProvider {
+	provider := viper.GetString("identity.provider")
+
+	log.Info("Identity provider: ", provider)
+
+	if provider == "local" {
+		idp, err := NewLocalIdentity(users, []byte(viper.GetString("identity.secret")))
+
+		if err != nil {
+			log.Fatalf("Could not create identity provider: %v", err)
+		}
+
+		return idp
+	}
+
+	return NewCognito()
+}
+
+// withIdentity makes the identity provider available to the handlers of a
+// request.
+func withIdentity(idp IdentityProvider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(identityKey, idp)
+		c.Next()
+	}
+}
+
+// identityFrom returns the identity provider registered by withIdentity.
+func identityFrom(c *gin.Context) IdentityProvider {
+	return c.MustGet(identityKey).(IdentityProvider)
+}
+
+// authErrorMessage returns a message suitable for showing to the user
+func authErrorMessage(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Message()
+	}
+	return err.Error()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var errInvalidCredentials = errors.New("Incorrect username or password.")
+
+// LocalIdentity is an identity provider that keeps bcrypt password hashes in
+// the user store and issues its own HMAC signed JWTs. It is meant for
+// environments without a Cognito user pool. Tokens carry the TokenVersion
+// of their user, which SignOut increments in the store, so revocations are
+// shared by all instances and survive restarts. Instances with their own
+// "lru" cache notice within 'cache.ttl'.
+type LocalIdentity struct {
+	users  UserStore
+	secret []byte
+}
+
+// NewLocalIdentity creates a local identity provider signing with secret,
+// which must be the same on every instance
+func NewLocalIdentity(users UserStore, secret []byte) (*LocalIdentity, error) {
+
+	if len(secret) == 0 {
+		return nil, errors.New("identity.secret is not set")
+	}
+
+	return &LocalIdentity{
+		users:  users,
+		secret: secret,
+	}, nil
+}
+
+// SignUp creates the user record with the hashed password and signs in
+func (l *LocalIdentity) SignUp(username string, password string, email string, fullName string) (*Tokens, error) {
+
+	if _, err := l.users.FindByUsername(username); err == nil {
+		return nil, errors.New("User already exists")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user{
+		ID:           uuid.NewV4().String(),
+		Username:     username,
+		Email:        email,
+		FullName:     fullName,
+		PasswordHash: string(hash),
+	}
+
+	if err := l.users.Put(u); err != nil {
+		return nil, err
+	}
+
+	log.Info("Created local user: ", username)
+
+	return l.issue(u)
+}
+
+// SignIn checks the password against the stored hash
+func (l *LocalIdentity) SignIn(username string, password string) (*Tokens, error) {
+
+	u, err := uncachedUsers(l.users).FindByUsername(username)
+
+	if err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return nil, errInvalidCredentials
+	}
+
+	return l.issue(u)
+}
+
+// ValidateToken validates an access token and returns the 'sub' claim
+func (l *LocalIdentity) ValidateToken(accessToken string) (string, error) {
+
+	u, err := l.validate(accessToken, "access")
+
+	if err != nil {
+		return "", err
+	}
+
+	return u.ID, nil
+}
+
+// RefreshToken issues a new access token for a valid refresh token
+func (l *LocalIdentity) RefreshToken(refreshToken string) (*Tokens, error) {
+
+	u, err := l.validate(refreshToken, "refresh")
+
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := l.sign(u, "access", accessTokenTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{AccessToken: access, RefreshToken: refreshToken}, nil
+}
+
+// SignOut revokes every token issued to the user so far, like a Cognito
+// global sign out
+func (l *LocalIdentity) SignOut(accessToken string) error {
+
+	sub, err := l.ValidateToken(accessToken)
+
+	if err != nil {
+		return err
+	}
+
+	return l.users.RevokeTokens(sub)
+}
+
+func (l *LocalIdentity) issue(u *user) (*Tokens, error) {
+
+	access, err := l.sign(u, "access", accessTokenTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := l.sign(u, "refresh", refreshTokenTTL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tokens{AccessToken: access, RefreshToken: refresh}, nil
+}
+
+// localClaims mirrors the Cognito claims the app relies on
+type localClaims struct {
+	TokenUse string `json:"token_use"`
+	Version  uint   `json:"ver,omitempty"` // TokenVersion of the user
+	jwt.StandardClaims
+}
+
+func (l *LocalIdentity) sign(u *user, use string, ttl time.Duration) (string, error) {
+
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &localClaims{
+		TokenUse: use,
+		Version:  u.TokenVersion,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.NewV4().String(),
+			Subject:   u.ID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	})
+
+	return token.SignedString(l.secret)
+}
+
+func (l *LocalIdentity) parse(tokenString string) (*localClaims, error) {
+
+	claims := &localClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return l.secret, nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse JWT: %v", err)
+	}
+
+	return claims, nil
+}
+
+// validate checks the token and returns its user, as long as the token was
+// issued for the current TokenVersion
+func (l *LocalIdentity) validate(tokenString string, use string) (*user, error) {
+
+	claims, err := l.parse(tokenString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TokenUse != use {
+		return nil, fmt.Errorf("token_use mismatch: %s", claims.TokenUse)
+	}
+
+	u, err := l.users.FindByID(claims.Subject)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Version != u.TokenVersion {
+		return nil, errors.New("token has been revoked")
+	}
+
+	return u, nil
+}
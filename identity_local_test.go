@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestLocalIdentitySignOut(t *testing.T) {
+
+	if _, err := NewLocalIdentity(NewMemoryStores().Users, nil); err == nil {
+		t.Error("NewLocalIdentity() without a secret succeeded")
+	}
+
+	users := NewMemoryStores().Users
+	idp, _ := NewLocalIdentity(users, []byte("secret"))
+
+	old, err := idp.SignUp("alice", "password", "alice@example.com", "Alice")
+
+	if err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+
+	if _, err := idp.ValidateToken(old.AccessToken); err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+
+	// Signing out within the same second as the sign in revokes the tokens
+
+	if err := idp.SignOut(old.AccessToken); err != nil {
+		t.Fatalf("SignOut() error = %v", err)
+	}
+
+	tokens, err := idp.SignIn("alice", "password")
+
+	if err != nil {
+		t.Fatalf("SignIn() error = %v", err)
+	}
+
+	// A restarted instance sharing the store agrees
+
+	restarted, _ := NewLocalIdentity(users, []byte("secret"))
+
+	for _, l := range []*LocalIdentity{idp, restarted} {
+		if _, err := l.ValidateToken(old.AccessToken); err == nil {
+			t.Error("ValidateToken() accepted a revoked access token")
+		}
+
+		if _, err := l.RefreshToken(old.RefreshToken); err == nil {
+			t.Error("RefreshToken() accepted a revoked refresh token")
+		}
+
+		if _, err := l.ValidateToken(tokens.AccessToken); err != nil {
+			t.Errorf("ValidateToken() of a new token error = %v", err)
+		}
+	}
+}
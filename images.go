@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/zoharngo/insta.git/imaging"
+	"github.com/zoharngo/insta.git/objectstore"
+)
+
+// JPEG, PNG, GIF and WebP images are decoded in process, by the Lambda
+// function too. HEIC needs the converter in 'images.heicDecoder'; without it
+// such uploads are rejected since they cannot be checked. Thumbnails of
+// externally decoded formats are always made in the web process since the
+// Lambda function has no converter.
+
+// registerDecoders registers the external decoders configured in [images]
+func registerDecoders() {
+
+	path := viper.GetString("images.heicDecoder")
+
+	if path == "" {
+		log.Info("HEIC decoder: none")
+		return
+	}
+
+	decoder, err := imaging.NewCommand(path)
+
+	if err != nil {
+		log.Errorf("Could not find HEIC decoder %s: %v", path, err)
+		return
+	}
+
+	log.Info("HEIC decoder: ", path)
+
+	imaging.Register(imaging.HEIC, decoder)
+}
+
+// thumbnailFormat is the output format of image thumbnails, 'thumbnails.format'
+// "jpeg" or "png"
+func thumbnailFormat() string {
+
+	if viper.GetString("thumbnails.format") == imaging.PNG {
+		return imaging.PNG
+	}
+
+	return imaging.JPEG
+}
+
+// thumbnailQuality is the JPEG quality of thumbnails, 85 unless
+// 'thumbnails.quality' says otherwise
+func thumbnailQuality() int {
+
+	quality := viper.GetInt("thumbnails.quality")
+	if quality <= 0 || quality > 100 {
+		quality = 85
+	}
+
+	return quality
+}
+
+// unsupportedFormat is the ThumbnailError of images that cannot be decoded
+func unsupportedFormat(format string) string {
+	return strings.ToUpper(format) + " images are not supported yet"
+}
+
+// generateThumbnail decodes the image item and stores it scaled to maxWidth
+// in thumbnailFormat
+func generateThumbnail(objects objectstore.ObjectStore, item mediaItem, maxWidth uint) error {
+
+	log.Infof("Fetching %v", item.Key())
+
+	body, err := objects.Get(item.Key())
+
+	if err != nil {
+		log.Errorf("Could not download original: %v", err)
+		return err
+	}
+
+	defer body.Close()
+
+	log.Infof("Decoding image")
+
+	img, format, err := imaging.Decode(body)
+
+	if err != nil {
+		log.Errorf("Could not decode %s image: %v", format, err)
+		return err
+	}
+
+	log.Infof("Generating thumbnail")
+	thumbnail := imaging.Thumbnail(img, maxWidth)
+
+	log.Infof("Encoding image for upload")
+	buf := new(bytes.Buffer)
+
+	if err := imaging.Encode(buf, thumbnail, thumbnailFormat(), thumbnailQuality()); err != nil {
+		log.Errorf("Encoding error: %v", err)
+		return err
+	}
+
+	log.Infof("Preparing object: %s", item.ThumbKey())
+
+	if err := objects.Put(item.ThumbKey(), buf, imaging.ContentType(thumbnailFormat())); err != nil {
+		log.Error("Failed to upload", err)
+		return err
+	}
+
+	log.Println("Successfully uploaded to", objects.URL(item.ThumbKey()))
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Command decodes images with a converter that takes an input and an output
+// file name and writes PNG, like heif-dec from libheif.
+type Command struct {
+	path string
+}
+
+// NewCommand returns a decoder running the converter at path, looked up in
+// PATH unless it contains a separator.
+func NewCommand(path string) (*Command, error) {
+
+	path, err := exec.LookPath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Command{path: path}, nil
+}
+
+// Decode implements Decoder.
+func (c *Command) Decode(r io.Reader) (image.Image, error) {
+
+	dir, err := ioutil.TempDir("", "imaging-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in")
+	out := filepath.Join(dir, "out.png")
+
+	file, err := os.Create(in)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(file, r)
+
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var stderr bytes.Buffer
+
+	cmd := exec.Command(c.path, in, out)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", filepath.Base(c.path), err, strings.TrimSpace(stderr.String()))
+	}
+
+	result, err := os.Open(out)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer result.Close()
+
+	return png.Decode(result)
+}
@@ -0,0 +1,164 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+)
+
+// ErrMalformed is returned for HEIF files whose header cannot be read.
+var ErrMalformed = errors.New("Malformed HEIF file")
+
+// maxMetaSize caps the meta box read into memory. It holds the item
+// properties and locations only, real files need a few kilobytes.
+const maxMetaSize = 1 << 20
+
+// heifConfig reads the image size from the ispe properties in the meta box
+// of a HEIF file, without decoding any image data. Files also hold tiles and
+// thumbnails, which are smaller than the primary image, so the largest
+// property is its size; crafted files with larger items are bounded too.
+func heifConfig(r io.Reader) (image.Config, error) {
+
+	for {
+		var hdr [16]byte
+
+		if _, err := io.ReadFull(r, hdr[:8]); err != nil {
+			return image.Config{}, ErrMalformed
+		}
+
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		header := int64(8)
+
+		if size == 1 { // 64 bit size follows the type
+			if _, err := io.ReadFull(r, hdr[8:16]); err != nil {
+				return image.Config{}, ErrMalformed
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			header = 16
+		}
+
+		// The meta box comes before the image data, a box extending to the
+		// end of the file (size 0) means it is missing
+		if size < header {
+			return image.Config{}, ErrMalformed
+		}
+
+		if typ != "meta" {
+			if _, err := io.CopyN(ioutil.Discard, r, size-header); err != nil {
+				return image.Config{}, ErrMalformed
+			}
+			continue
+		}
+
+		if size-header > maxMetaSize {
+			return image.Config{}, ErrMalformed
+		}
+
+		meta := make([]byte, size-header)
+
+		if _, err := io.ReadFull(r, meta); err != nil {
+			return image.Config{}, ErrMalformed
+		}
+
+		return metaConfig(meta)
+	}
+}
+
+// metaConfig finds the largest ispe property in the payload of a meta box
+func metaConfig(meta []byte) (image.Config, error) {
+
+	var config image.Config
+
+	// meta and ispe are full boxes starting with version and flags
+	if len(meta) < 4 {
+		return config, ErrMalformed
+	}
+
+	iprp := childBox(meta[4:], "iprp")
+	ipco := childBox(iprp, "ipco")
+
+	err := eachBox(ipco, func(typ string, payload []byte) error {
+		if typ != "ispe" {
+			return nil
+		}
+
+		if len(payload) < 12 {
+			return ErrMalformed
+		}
+
+		if w := int(binary.BigEndian.Uint32(payload[4:8])); w > config.Width {
+			config.Width = w
+		}
+
+		if h := int(binary.BigEndian.Uint32(payload[8:12])); h > config.Height {
+			config.Height = h
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return config, err
+	}
+
+	if config.Width == 0 || config.Height == 0 {
+		return config, ErrMalformed
+	}
+
+	return config, nil
+}
+
+// childBox returns the payload of the first box of the type in b, or nil
+func childBox(b []byte, typ string) []byte {
+
+	var found []byte
+
+	eachBox(b, func(t string, payload []byte) error {
+		if found == nil && t == typ {
+			found = payload
+		}
+		return nil
+	})
+
+	return found
+}
+
+// eachBox calls fn with the type and payload of the boxes in b
+func eachBox(b []byte, fn func(typ string, payload []byte) error) error {
+
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return ErrMalformed
+		}
+
+		size := uint64(binary.BigEndian.Uint32(b[:4]))
+		typ := string(b[4:8])
+		header := uint64(8)
+
+		switch size {
+		case 0: // extends to the end of the parent
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return ErrMalformed
+			}
+			size = binary.BigEndian.Uint64(b[8:16])
+			header = 16
+		}
+
+		if size < header || size > uint64(len(b)) {
+			return ErrMalformed
+		}
+
+		if err := fn(typ, b[header:size]); err != nil {
+			return err
+		}
+
+		b = b[size:]
+	}
+
+	return nil
+}
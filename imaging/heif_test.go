@@ -0,0 +1,54 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// box returns an ISO BMFF box of the given type around the payloads
+func box(typ string, payloads ...[]byte) []byte {
+
+	body := bytes.Join(payloads, nil)
+
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+
+	return append(b, body...)
+}
+
+func ispe(width, height uint32) []byte {
+
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b[4:], width)
+	binary.BigEndian.PutUint32(b[8:], height)
+
+	return box("ispe", b)
+}
+
+func TestDecodeConfigHEIC(t *testing.T) {
+
+	ftyp := box("ftyp", []byte("heic"), make([]byte, 4), []byte("mif1heic"))
+	meta := box("meta", make([]byte, 4), box("hdlr", make([]byte, 24)),
+		box("iprp", box("ipco", ispe(512, 512), box("hvcC", make([]byte, 23)), ispe(20000, 15000))))
+
+	// The image data is never read
+	file := bytes.Join([][]byte{ftyp, meta, box("mdat", make([]byte, 64))}, nil)
+
+	config, format, err := DecodeConfig(bytes.NewReader(file))
+
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+
+	if format != HEIC || config.Width != 20000 || config.Height != 15000 {
+		t.Errorf("DecodeConfig() = %s %dx%d, want heic 20000x15000", format, config.Width, config.Height)
+	}
+
+	for _, broken := range [][]byte{ftyp, append(ftyp, meta[:len(meta)-4]...), append(ftyp, box("meta", make([]byte, 4))...)} {
+		if _, _, err := DecodeConfig(bytes.NewReader(broken)); err != ErrMalformed {
+			t.Errorf("DecodeConfig() of %d bytes error = %v, want ErrMalformed", len(broken), err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package imaging detects and decodes the image formats accepted for uploads
+// and encodes their thumbnails. JPEG, PNG, GIF and WebP are decoded in
+// process; formats like HEIC need an external Decoder to be registered.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // GIF decodes to its first frame
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"sync"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnsupported is returned for formats without a decoder.
+var ErrUnsupported = errors.New("Unsupported image format")
+
+// Formats, as returned by Detect
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	GIF  = "gif"
+	WebP = "webp"
+	HEIC = "heic"
+)
+
+// contentTypes maps the detected formats to their MIME types.
+var contentTypes = map[string]string{
+	JPEG: "image/jpeg",
+	PNG:  "image/png",
+	GIF:  "image/gif",
+	WebP: "image/webp",
+	HEIC: "image/heic",
+}
+
+// heicBrands are the major brands of HEIF files with HEVC coded images.
+var heicBrands = map[string]bool{
+	"heic": true,
+	"heix": true,
+	"heim": true,
+	"heis": true,
+	"mif1": true,
+	"msf1": true,
+}
+
+// avifBrands are the major brands of HEIF files with AV1 coded images.
+var avifBrands = map[string]bool{
+	"avif": true,
+	"avis": true,
+}
+
+// IsImageBrand reports whether an MP4 style major brand is one of a HEIF
+// still image, HEIC or AVIF, rather than of a video.
+func IsImageBrand(brand string) bool {
+	return heicBrands[brand] || avifBrands[brand]
+}
+
+// Decoder decodes a format the standard library cannot.
+type Decoder interface {
+	Decode(r io.Reader) (image.Image, error)
+}
+
+var (
+	mu       sync.RWMutex
+	decoders = map[string]Decoder{}
+)
+
+// Register makes d decode the given format.
+func Register(format string, d Decoder) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	decoders[format] = d
+}
+
+func external(format string) Decoder {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return decoders[format]
+}
+
+// Detect returns the format of an image from its first bytes, or "" if it
+// is none of the formats above.
+func Detect(head []byte) string {
+
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" && heicBrands[string(head[8:12])] {
+		return HEIC
+	}
+
+	switch http.DetectContentType(head) {
+	case "image/jpeg":
+		return JPEG
+	case "image/png":
+		return PNG
+	case "image/gif":
+		return GIF
+	case "image/webp":
+		return WebP
+	}
+
+	return ""
+}
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Extension returns the file extension of a format, e.g. ".jpg".
+func Extension(format string) string {
+
+	if format == JPEG {
+		return ".jpg"
+	}
+
+	return "." + format
+}
+
+// IsExternal reports whether the format is decoded by a registered Decoder
+// instead of in process.
+func IsExternal(format string) bool {
+	return format == HEIC
+}
+
+// Supported reports whether images of the format can be decoded.
+func Supported(format string) bool {
+
+	if IsExternal(format) {
+		return external(format) != nil
+	}
+
+	return contentTypes[format] != ""
+}
+
+// Decode detects the format of the image and decodes it. Returns
+// ErrUnsupported, along with the format, for formats without a decoder.
+func Decode(r io.Reader) (image.Image, string, error) {
+
+	format, r, err := detect(r)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !Supported(format) {
+		return nil, format, ErrUnsupported
+	}
+
+	if IsExternal(format) {
+		img, err := external(format).Decode(r)
+		return img, format, err
+	}
+
+	img, _, err := image.Decode(r)
+
+	return img, format, err
+}
+
+// DecodeConfig returns the dimensions of the image from its header, without
+// decoding it. HEIC headers are read in process, whether or not a Decoder is
+// registered; only the size is known for them.
+func DecodeConfig(r io.Reader) (image.Config, string, error) {
+
+	format, r, err := detect(r)
+
+	if err != nil {
+		return image.Config{}, "", err
+	}
+
+	if format == HEIC {
+		config, err := heifConfig(r)
+		return config, format, err
+	}
+
+	if !Supported(format) {
+		return image.Config{}, format, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(r)
+
+	return config, format, err
+}
+
+// detect reads the first bytes of r and returns the format and a reader
+// starting over from the beginning
+func detect(r io.Reader) (string, io.Reader, error) {
+
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(r, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, err
+	}
+
+	head = head[:n]
+
+	return Detect(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
@@ -0,0 +1,30 @@
+package imaging
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"github.com/nfnt/resize"
+)
+
+// Thumbnail scales img to fit into a maxSize square.
+func Thumbnail(img image.Image, maxSize uint) image.Image {
+	return resize.Thumbnail(maxSize, maxSize, img, resize.Lanczos3)
+}
+
+// Encode writes img in the output format, JPEG with the given quality or
+// PNG.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+
+	switch format {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case PNG:
+		return png.Encode(w, img)
+	}
+
+	return fmt.Errorf("cannot encode %q images", format)
+}
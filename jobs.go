@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// job is background work kept in the JobStore until it succeeds. Failed
+// attempts are retried later with exponential backoff, so work that stops
+// halfway is finished eventually instead of leaving orphans behind.
+type job struct {
+	ID        string
+	Kind      string
+	Payload   string // JSON arguments, see jobKinds
+	Attempts  int
+	RunAt     time.Time // next attempt, in UTC
+	LastError string
+	CreatedAt time.Time
+}
+
+// jobKinds runs the jobs of every kind with their payload. Jobs must be
+// idempotent: a retry repeats the steps that already succeeded, and with
+// several instances the same job may run twice at once.
+var jobKinds = map[string]func(st *Stores, payload string) error{
+	purgePhotoJob: purgePhoto,
+}
+
+// jobsBatch is how many due jobs are loaded at a time
+const jobsBatch = 100
+
+// wakeJobs lets enqueueJob start the worker before its next tick
+var wakeJobs = make(chan struct{}, 1)
+
+// enqueueJob stores a job that runs args as soon as possible
+func enqueueJob(st *Stores, kind string, args interface{}) error {
+
+	payload, err := json.Marshal(args)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	err = st.Jobs.Put(&job{
+		ID:        uuid.NewV4().String(),
+		Kind:      kind,
+		Payload:   string(payload),
+		RunAt:     now,
+		CreatedAt: now,
+	})
+
+	if err != nil {
+		log.Errorf("failed to put job record, %v", err)
+		return err
+	}
+
+	select {
+	case wakeJobs <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// startJobs runs due jobs in the background every 'jobs.interval' and
+// whenever one is enqueued
+func startJobs(st *Stores) {
+
+	interval := viper.GetDuration("jobs.interval")
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			runDueJobs(st)
+
+			select {
+			case <-ticker.C:
+			case <-wakeJobs:
+			}
+		}
+	}()
+}
+
+// runDueJobs runs the jobs that are due and returns how many succeeded
+func runDueJobs(st *Stores) int {
+
+	done := 0
+
+	for {
+		jobs, err := st.Jobs.Due(time.Now(), jobsBatch)
+
+		if err != nil {
+			log.Errorf("Error loading jobs: %v", err)
+			return done
+		}
+
+		succeeded := 0
+		for i := range jobs {
+			if runJob(st, &jobs[i]) {
+				succeeded++
+			}
+		}
+
+		done += succeeded
+
+		// Jobs that failed are rescheduled, so stop when a batch made no
+		// progress or there is nothing left
+		if len(jobs) < jobsBatch || succeeded == 0 {
+			return done
+		}
+	}
+}
+
+// runJob runs j once, then deletes it or schedules the next attempt
+func runJob(st *Stores, j *job) bool {
+
+	err := fmt.Errorf("unknown job kind %q", j.Kind)
+
+	if run, ok := jobKinds[j.Kind]; ok {
+		err = run(st, j.Payload)
+	}
+
+	if err == nil {
+		log.Infof("Job %s (%s) done", j.ID, j.Kind)
+
+		if err := st.Jobs.Delete(j.ID); err != nil {
+			log.Errorf("failed to delete job record, %v", err)
+		}
+
+		return true
+	}
+
+	j.Attempts++
+	j.LastError = err.Error()
+	j.RunAt = time.Now().UTC().Add(retryDelay(j.Attempts))
+
+	log.Errorf("Job %s (%s) failed, attempt %d, retrying at %s: %v", j.ID, j.Kind, j.Attempts, j.RunAt, err)
+
+	if err := st.Jobs.Put(j); err != nil {
+		log.Errorf("failed to put job record, %v", err)
+	}
+
+	return false
+}
+
+// retryDelay doubles 'jobs.retryDelay' with every attempt, up to
+// 'jobs.maxRetryDelay'
+func retryDelay(attempts int) time.Duration {
+
+	delay := viper.GetDuration("jobs.retryDelay")
+	if delay <= 0 {
+		delay = 30 * time.Second
+	}
+
+	max := viper.GetDuration("jobs.maxRetryDelay")
+	if max <= 0 {
+		max = time.Hour
+	}
+
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// runJobs runs the due jobs once, e.g. from cron when no web server runs
+func runJobs(st *Stores, args []string) error {
+
+	log.Infof("Ran %d jobs", runDueJobs(st))
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zoharngo/insta.git/objectstore"
+)
+
+// Objects are named after the photo ID so uploads never overwrite each
+// other, whatever the files were called. Posts from before that used the
+// uploaded name and are moved by the migratekeys command.
+
+// extensions normalizes the extension of the sniffed content types
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/heic": ".heic",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// objectName names the item at index i of the post photoid, e.g.
+// "<photoid>.jpg" for the cover and "<photoid>-2.jpg" for the next one
+func objectName(photoid string, i int, ext string) string {
+
+	if i == 0 {
+		return photoid + ext
+	}
+
+	return fmt.Sprintf("%s-%d%s", photoid, i+1, ext)
+}
+
+// normalizedExt returns the extension of the content type, falling back to
+// the lower case extension of filename for types without one
+func normalizedExt(contentType string, filename string) string {
+
+	if ext, ok := extensions[contentType]; ok {
+		return ext
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+
+	return ext
+}
+
+// hasLegacyKeys reports whether any item of p is still named after its upload
+func hasLegacyKeys(p *photo) bool {
+	for _, item := range p.Items() {
+		if !strings.HasPrefix(item.Filename, p.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateKeys copies the objects of posts from before collision-free keys to
+// keys derived from the photo ID, renames their items and removes the old
+// objects. It can be run again after a failure.
+func migrateKeys(st *Stores, args []string) error {
+
+	// Photos of a user that were uploaded with the same name share one
+	// object, so count the references and delete an old object only once no
+	// photo uses it anymore
+
+	refs := map[string]int{}
+	legacy := []photo{}
+
+	err := forEachPhoto(st, func(p *photo) error {
+		if hasLegacyKeys(p) {
+			for _, item := range p.Items() {
+				refs[item.Key()]++
+			}
+			legacy = append(legacy, *p)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for i := range legacy {
+		if err := migratePhoto(st, &legacy[i], refs); err != nil {
+			return fmt.Errorf("failed to migrate photo %s, %v", legacy[i].ID, err)
+		}
+	}
+
+	log.Infof("Migrated %d photos", len(legacy))
+
+	return nil
+}
+
+// migratePhoto moves the legacy items of p and deletes the old objects that
+// no other photo refers to
+func migratePhoto(st *Stores, p *photo, refs map[string]int) error {
+
+	old := p.Items()
+	items := p.Items()
+	moved := 0
+
+	for i := range items {
+		if strings.HasPrefix(items[i].Filename, p.ID) {
+			continue
+		}
+
+		if err := moveItem(st.Objects, p.ID, i, &items[i]); err != nil {
+			return err
+		}
+		moved++
+	}
+
+	if err := st.Photos.SetMedia(p.ID, items); err != nil {
+		return err
+	}
+
+	log.Infof("Photo %s: moved %d items", p.ID, moved)
+
+	for i, item := range old {
+		if item.Filename == items[i].Filename {
+			continue
+		}
+
+		if refs[item.Key()]--; refs[item.Key()] > 0 {
+			continue
+		}
+
+		for _, key := range []string{item.ThumbKey(), item.Key()} {
+			if err := st.Objects.Delete(key); err != nil && err != objectstore.ErrNotFound {
+				log.Errorf("failed to remove object %s, %v", key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// moveItem copies the original and thumbnail of a legacy item to the keys of
+// the item at index i of photoid and renames it. The old objects are kept.
+func moveItem(objects objectstore.ObjectStore, photoid string, i int, item *mediaItem) error {
+
+	from := *item
+
+	item.OriginalFilename = from.Filename
+
+	body, err := objects.Get(from.Key())
+
+	if err == objectstore.ErrNotFound {
+		log.Warnf("Object %s is missing, renaming only", from.Key())
+		item.Filename = objectName(photoid, i, normalizedExt("", from.Filename))
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer body.Close()
+
+	// The extension of the old name cannot be trusted, sniff the content
+
+	br := bufio.NewReaderSize(body, 512)
+	head, _ := br.Peek(512)
+	contentType := sniffContentType(head)
+
+	item.Filename = objectName(photoid, i, normalizedExt(contentType, from.Filename))
+
+	if err := objects.Put(item.Key(), br, contentType); err != nil {
+		return err
+	}
+
+	thumb, err := objects.Get(from.ThumbKey())
+
+	if err == objectstore.ErrNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer thumb.Close()
+
+	return objects.Put(item.ThumbKey(), thumb, "image/jpeg")
+}
+
+// forEachPhoto calls fn with every photo of every user, trashed ones
+// included
+func forEachPhoto(st *Stores, fn func(p *photo) error) error {
+
+	var start pageKey
+
+	for {
+		users, next, err := st.Users.List(start, maxPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			for _, list := range []func(string, pageKey, int) ([]photo, pageKey, error){st.Photos.ByUser, st.Photos.Trashed} {
+				if err := forEachPage(u.ID, list, fn); err != nil {
+					return err
+				}
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+		start = next
+	}
+}
+
+// forEachPage calls fn with every photo of the user listed by list
+func forEachPage(userid string, list func(string, pageKey, int) ([]photo, pageKey, error), fn func(p *photo) error) error {
+
+	var start pageKey
+
+	for {
+		photos, next, err := list(userid, start, maxPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range photos {
+			if err := fn(&photos[i]); err != nil {
+				return err
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+		start = next
+	}
+}
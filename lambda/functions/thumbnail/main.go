@@ -3,24 +3,39 @@ package main
 import (
 	"bytes"
 	"context"
-	"image/jpeg"
 	"log"
+	"os"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/nfnt/resize"
+	"github.com/zoharngo/insta.git/imaging"
+	"github.com/zoharngo/insta.git/objectstore"
 )
 
+// output and quality select the thumbnail format, from THUMBNAIL_FORMAT
+// ("jpeg" or "png") and THUMBNAIL_QUALITY
+var output, quality = imaging.JPEG, 85
+
+func init() {
+
+	if os.Getenv("THUMBNAIL_FORMAT") == imaging.PNG {
+		output = imaging.PNG
+	}
+
+	if q, err := strconv.Atoi(os.Getenv("THUMBNAIL_QUALITY")); err == nil && q > 0 && q <= 100 {
+		quality = q
+	}
+}
+
 // HandleRequest - Handling Asynchronous Image Resizing with Lambda and S3
 func HandleRequest(ctx context.Context, s3Event events.S3Event) error {
-	for _, record := range s3Event.Records {
+	sess := session.New()
 
-		sess := session.New()
+	for _, record := range s3Event.Records {
 
 		bucket := record.S3.Bucket.Name
 		key := record.S3.Object.Key
@@ -34,68 +49,68 @@ func HandleRequest(ctx context.Context, s3Event events.S3Event) error {
 			continue
 		}
 
+		// The web app makes the posters of videos itself
+
+		if ext := strings.ToLower(path.Ext(key)); ext == ".mp4" || ext == ".webm" {
+			continue
+		}
+
+		objects := objectstore.NewS3(sess, bucket)
+
 		log.Printf("Fetching s3://%v/%v", bucket, key)
 
-		buff := &aws.WriteAtBuffer{}
-		s3dl := s3manager.NewDownloader(sess)
-		_, err := s3dl.Download(buff, &s3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
-		})
+		body, err := objects.Get(key)
 
 		if err != nil {
 			log.Printf("Could not download from S3: %v", err)
 			continue
 		}
 
-		log.Printf("Decoding image: %v bytes", len(buff.Bytes()))
+		log.Printf("Decoding image")
+
+		// Formats needing an external decoder are left to the web app, which
+		// notes on the photo record when it cannot decode them either
+
+		img, format, err := imaging.Decode(body)
+		body.Close()
 
-		imageBytes := buff.Bytes()
-		reader := bytes.NewReader(imageBytes)
+		if err == imaging.ErrUnsupported {
+			log.Printf("Skipping %q image", format)
+			continue
+		}
 
-		img, err := jpeg.Decode(reader)
 		if err != nil {
 			log.Printf("bad response: %s", err)
 			continue
 		}
 
 		log.Printf("Generating thumbnail")
-		thumbnail := resize.Thumbnail(600, 600, img, resize.Lanczos3)
-
-		if thumbnail == nil {
-			log.Printf("resize.Thumbnail returned nil")
-			continue
-		}
+		thumbnail := imaging.Thumbnail(img, 600)
 
 		log.Printf("Encoding image for upload to S3")
 		buf := new(bytes.Buffer)
-		err = jpeg.Encode(buf, thumbnail, nil)
+		err = imaging.Encode(buf, thumbnail, output, quality)
 
 		if err != nil {
-			log.Printf("JPEG encoding error: %v", err)
+			log.Printf("Encoding error: %v", err)
 			continue
 		}
 
-		// Filename: e5f97749-5d2f-4770-89ce-5d68b1a90f7b/filename.jpg
+		// Filename: e5f97749-5d2f-4770-89ce-5d68b1a90f7b/filename.png
 		// Thumbnail: e5f97749-5d2f-4770-89ce-5d68b1a90f7b/thumb/filename.jpg
 
-		thumbkey := strings.Replace(key, "/", "/thumb/", -1)
+		thumbkey := strings.Replace(strings.TrimSuffix(key, path.Ext(key)), "/", "/thumb/", -1) + imaging.Extension(output)
 
 		log.Printf("Preparing S3 object: %s", thumbkey)
 
-		uploader := s3manager.NewUploader(sess)
-		result, err := uploader.Upload(&s3manager.UploadInput{
-			Body:   bytes.NewReader(buf.Bytes()),
-			Bucket: aws.String(bucket),
-			Key:    aws.String(thumbkey),
-		})
+		err = objects.Put(thumbkey, buf, imaging.ContentType(output))
 
 		if err != nil {
 			log.Printf("Failed to upload: %v", err)
 			continue
 		}
 
-		log.Printf("Successfully uploaded to: %v", result.Location)
+		log.Printf("Successfully uploaded to: %v", objects.URL(thumbkey))
 
 	}
 	return nil
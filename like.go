@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// like records that a user liked a photo. There is at most one per user and
+// photo; the stores keep photo.Likes in sync with the number of likes.
+type like struct {
+	PhotoID   string
+	UserID    string
+	CreatedAt time.Time
+}
+
+// likePhoto records a like of userid and returns the new 'Likes' count.
+// Liking a photo twice counts once. Callers check canInteractWithPhoto.
+func likePhoto(st *Stores, id string, userid string) (uint, error) {
+
+	err := st.Likes.Add(&like{
+		PhotoID:   id,
+		UserID:    userid,
+		CreatedAt: time.Now(),
+	})
+
+	if err != nil && err != errExists {
+		log.Errorf("failed to put like record, %v", err)
+		return 0, err
+	}
+
+	return likeCount(st, id)
+}
+
+// unlikePhoto removes the like of userid and returns the new 'Likes' count.
+// Unliking a photo that is not liked does nothing.
+func unlikePhoto(st *Stores, id string, userid string) (uint, error) {
+
+	if _, err := st.Photos.Get(id); err != nil {
+		return 0, err
+	}
+
+	if err := st.Likes.Remove(id, userid); err != nil && err != errNotFound {
+		log.Errorf("failed to delete like record, %v", err)
+		return 0, err
+	}
+
+	return likeCount(st, id)
+}
+
+func likeCount(st *Stores, id string) (uint, error) {
+
+	photo, err := st.Photos.Get(id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return photo.Likes, nil
+}
+
+// likers returns a page of the users who liked the photo
+func likers(st *Stores, id string, start pageKey, limit int) ([]user, pageKey, error) {
+
+	likes, next, err := st.Likes.ByPhoto(id, start, limit)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]string, 0, len(likes))
+	for _, l := range likes {
+		ids = append(ids, l.UserID)
+	}
+
+	users, err := st.Users.FindMany(ids)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return users, next, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const userLoaderKey = "userLoader"
+
+// userLoader resolves user IDs for a single request. Handlers prime it with
+// all the IDs a page needs so they are fetched in one batch; every user is
+// looked up at most once per request.
+type userLoader struct {
+	users UserStore
+	mu    sync.Mutex
+	cache map[string]*user // nil for IDs that do not exist
+}
+
+func newUserLoader(users UserStore) *userLoader {
+	return &userLoader{
+		users: users,
+		cache: map[string]*user{},
+	}
+}
+
+// withUserLoader gives every request its own userLoader. It must run after
+// withStores.
+func withUserLoader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(userLoaderKey, newUserLoader(storesFrom(c).Users))
+		c.Next()
+	}
+}
+
+// usersFrom returns the loader registered by withUserLoader
+func usersFrom(c *gin.Context) *userLoader {
+	return c.MustGet(userLoaderKey).(*userLoader)
+}
+
+// Prime fetches the users that are not loaded yet in one batch
+func (l *userLoader) Prime(ids ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if _, ok := l.cache[id]; !ok && !seen[id] {
+			missing = append(missing, id)
+			seen[id] = true
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	users, err := l.users.FindMany(missing)
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range missing {
+		l.cache[id] = nil
+	}
+	for i := range users {
+		l.cache[users[i].ID] = &users[i]
+	}
+
+	return nil
+}
+
+// Load returns the user with the given ID, or errNotFound
+func (l *userLoader) Load(id string) (*user, error) {
+
+	if err := l.Prime(id); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if u := l.cache[id]; u != nil {
+		return u, nil
+	}
+
+	return nil, errNotFound
+}
+
+// Username returns the username of the user with the given ID, or "" if it
+// cannot be loaded. Meant for templates.
+func (l *userLoader) Username(id string) string {
+
+	u, err := l.Load(id)
+
+	if err != nil {
+		if err != errNotFound {
+			log.Errorf("Error loading user %s: %v", id, err)
+		}
+		return ""
+	}
+
+	return u.Username
+}
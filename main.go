@@ -4,11 +4,49 @@ import (
 	"os"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
+// configLoaded is initialized before the init functions of the package run,
+// so config.toml is read once and they can all use it
+var configLoaded = loadConfig()
+
+// loadConfig reads config.toml from the working directory
+func loadConfig() bool {
+
+	log.Info("Loading configuration")
+	viper.SetConfigName("config") // config.toml
+	viper.AddConfigPath(".")      // use working directory
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Errorf("error reading config file, %v", err)
+		return false
+	}
+
+	return true
+}
+
 func main() {
 
-	r := registerRoutes()
+	if err := initPagination(); err != nil {
+		log.Fatal(err)
+	}
+
+	st := NewStores()
+
+	registerDecoders()
+
+	if len(os.Args) > 1 {
+		if err := runCommand(st, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	startJobs(st)
+	startSweeper(st)
+
+	r := registerRoutes(st, NewIdentityProvider(st.Users))
 
 	port := os.Getenv("PORT")
 
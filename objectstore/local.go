@@ -0,0 +1,172 @@
+package objectstore
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files below a root directory. The directory is
+// expected to be served over HTTP at baseURL.
+type Local struct {
+	root    string
+	baseURL string
+}
+
+// NewLocal creates an object store rooted at dir, creating it if needed
+func NewLocal(dir string, baseURL string) (*Local, error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &Local{root: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Root returns the directory the objects are stored in
+func (l *Local) Root() string {
+	return l.root
+}
+
+// path maps a key to a file below the root, rejecting keys that escape it
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", ErrNotFound
+	}
+	return filepath.Join(l.root, filepath.FromSlash(clean)), nil
+}
+
+// Put writes body to a temporary file and renames it into place so readers
+// never see a partial object
+func (l *Local) Put(key string, body io.Reader, contentType string) error {
+
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".upload-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get opens the object file
+func (l *Local) Get(key string) (io.ReadCloser, error) {
+
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return f, err
+}
+
+// Delete removes the object file
+func (l *Local) Delete(key string) error {
+
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Stat returns the object file metadata
+func (l *Local) Stat(key string) (*ObjectInfo, error) {
+
+	p, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) || (err == nil && fi.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return l.info(key, fi), nil
+}
+
+// List walks the root and returns the files whose key starts with prefix
+func (l *Local) List(prefix string) ([]ObjectInfo, error) {
+
+	objects := []ObjectInfo{}
+
+	err := filepath.Walk(l.root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, *l.info(key, fi))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// URL returns the object address below baseURL
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+func (l *Local) info(key string, fi os.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: fi.ModTime(),
+	}
+}
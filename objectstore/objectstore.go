@@ -0,0 +1,37 @@
+// Package objectstore abstracts the blob storage used for uploaded photos and
+// their thumbnails so the app can run against S3 or a local directory.
+package objectstore
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("Object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ObjectStore stores blobs by key. Keys use "/" as separator, e.g.
+// "<userid>/thumb/<filename>".
+type ObjectStore interface {
+	// Put stores the body under key, replacing any existing object.
+	Put(key string, body io.Reader, contentType string) error
+	// Get opens the object for reading. The caller must close it.
+	Get(key string) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(key string) error
+	// Stat returns the object's metadata.
+	Stat(key string) (*ObjectInfo, error)
+	// List returns all objects whose key starts with prefix.
+	List(prefix string) ([]ObjectInfo, error)
+	// URL returns the address browsers use to fetch the object.
+	URL(key string) string
+}
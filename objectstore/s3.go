@@ -0,0 +1,135 @@
+package objectstore
+
+import (
+	"io"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// S3 stores objects in an Amazon S3 bucket.
+type S3 struct {
+	bucket   string
+	svc      *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// NewS3 creates an object store for bucket
+func NewS3(sess *session.Session, bucket string) *S3 {
+	return &S3{
+		bucket:   bucket,
+		svc:      s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}
+}
+
+// Put uploads body to the bucket
+func (s *S3) Put(key string, body io.Reader, contentType string) error {
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	_, err := s.uploader.Upload(input)
+
+	return err
+}
+
+// Get opens the object body
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+
+	out, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return out.Body, nil
+}
+
+// Delete removes the object from the bucket
+func (s *S3) Delete(key string) error {
+
+	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	return err
+}
+
+// Stat returns the object metadata using a HEAD request
+func (s *S3) Stat(key string) (*ObjectInfo, error) {
+
+	out, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(out.ContentLength),
+		ContentType:  aws.StringValue(out.ContentType),
+		LastModified: aws.TimeValue(out.LastModified),
+	}, nil
+}
+
+// List returns the objects under prefix, following continuation tokens
+func (s *S3) List(prefix string) ([]ObjectInfo, error) {
+
+	objects := []ObjectInfo{}
+
+	err := s.svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, o := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.StringValue(o.Key),
+				Size:         aws.Int64Value(o.Size),
+				LastModified: aws.TimeValue(o.LastModified),
+			})
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// URL returns the public path-style S3 URL of the object
+func (s *S3) URL(key string) string {
+	u := url.URL{Scheme: "https", Host: "s3.amazonaws.com", Path: "/" + s.bucket + "/" + key}
+	return u.String()
+}
+
+// translate maps S3 "not found" errors to ErrNotFound
+func translate(err error) error {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return ErrNotFound
+		}
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const defaultPageSize = 24
+const maxPageSize = 100
+
+var errBadCursor = errors.New("Invalid page cursor")
+
+// pageKey identifies the last item of a page, like a DynamoDB
+// LastEvaluatedKey. All key attributes of the tables are strings. A nil key
+// means the first page when reading and no further page when returned.
+type pageKey map[string]string
+
+var cursorSecret []byte
+
+// initPagination reads 'pagination.secret', the key signing the cursors. It
+// must be set in release mode (GIN_MODE=release) so cursors stay valid
+// across instances and restarts; otherwise a random key is used.
+func initPagination() error {
+
+	cursorSecret = []byte(viper.GetString("pagination.secret"))
+
+	if len(cursorSecret) > 0 {
+		return nil
+	}
+
+	if gin.Mode() == gin.ReleaseMode {
+		return errors.New("pagination.secret is not set")
+	}
+
+	log.Warn("pagination.secret is not set, page cursors are only valid until the next restart")
+
+	cursorSecret = make([]byte, 32)
+	_, err := rand.Read(cursorSecret)
+
+	return err
+}
+
+// encodeCursor turns a page key into an opaque cursor signed with
+// 'pagination.secret', so clients cannot forge start keys
+func encodeCursor(key pageKey) string {
+
+	if len(key) == 0 {
+		return ""
+	}
+
+	payload, _ := json.Marshal(key)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signCursor(payload))
+}
+
+// decodeCursor verifies and decodes a cursor from encodeCursor. The empty
+// cursor decodes to a nil key.
+func decodeCursor(cursor string) (pageKey, error) {
+
+	if cursor == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(cursor, ".", 2)
+
+	if len(parts) != 2 {
+		return nil, errBadCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return nil, errBadCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil || !hmac.Equal(sig, signCursor(payload)) {
+		return nil, errBadCursor
+	}
+
+	key := pageKey{}
+
+	if err := json.Unmarshal(payload, &key); err != nil {
+		return nil, errBadCursor
+	}
+
+	return key, nil
+}
+
+func signCursor(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// pageSize reads the 'limit' query parameter
+func pageSize(c *gin.Context) int {
+
+	n, err := strconv.Atoi(c.Query("limit"))
+
+	if err != nil || n <= 0 {
+		return defaultPageSize
+	}
+
+	if n > maxPageSize {
+		return maxPageSize
+	}
+
+	return n
+}
@@ -1,53 +1,69 @@
 package main
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
-	"image/jpeg"
-	"mime"
+	"mime/multipart"
 	"net/http"
-	"path/filepath"
+	"path"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	humanize "github.com/dustin/go-humanize"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/nfnt/resize"
 	uuid "github.com/satori/go.uuid"
 	"github.com/spf13/viper"
+	"github.com/zoharngo/insta.git/imaging"
+	"github.com/zoharngo/insta.git/objectstore"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
+// photo is a post of one or more images. Filename is the first of them, the
+// cover shown in grids.
 type photo struct {
 	ID        string
 	UserID    string
 	Filename  string
+	Media     []mediaItem `dynamodbav:",omitempty"` // empty for posts from before carousels, see Items
 	Caption   string
 	CreatedAt time.Time
 	Likes     uint
+	DeletedAt *time.Time `dynamodbav:",omitempty"` // set while in the trash
+	Version   uint       // bumped by every caption edit
+	EditedAt  *time.Time `dynamodbav:",omitempty"`
+}
+
+// mediaItem is one image or video of a post. Filename names its object, see
+// objectName; the name it was uploaded with is only kept as metadata.
+type mediaItem struct {
+	Filename         string
+	OriginalFilename string        `dynamodbav:",omitempty"`
+	Type             string        `dynamodbav:",omitempty"` // videoItem, or empty for images
+	Format           string        `dynamodbav:",omitempty"` // of images, e.g. "png", see imaging.Detect
+	Codec            string        `dynamodbav:",omitempty"` // of videos, e.g. "avc1" or "vp9"
+	Duration         time.Duration `dynamodbav:",omitempty"` // of videos
+	ThumbFormat      string        `dynamodbav:",omitempty"` // of image thumbnails, empty for those named like the original
+	ThumbnailError   string        `dynamodbav:",omitempty"` // why there is no thumbnail
+	userid           string        // owner of the post, set by photo.Items
 }
 
 const thumbnailSize uint = 600
 
+// maxPostItems is how many images and videos a single post can hold
+const maxPostItems = 10
+
+// mediaPath is where the local object store is served from
+const mediaPath = "/media"
+
 var bucketName string
 
 func init() {
 
 	log.Info("Initializing S3")
 
-	log.Info("Loading configuration")
-	viper.SetConfigName("config") // config.toml
-	viper.AddConfigPath(".")      // use working directory
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Errorf("error reading config file, %v", err)
+	if !configLoaded {
 		return
 	}
 
@@ -56,212 +72,327 @@ func init() {
 	log.Info("S3 bucket: ", bucketName)
 }
 
-// FetchAllPhotos gets all photos for all users
-func FetchAllPhotos(c *gin.Context) {
-	sessionStore := sessions.Default(c)
-	uid := sessionStore.Get(userKey)
+// newObjectStore creates the blob store named by 'storage.backend'. Uploads
+// go to the S3 bucket unless "local" is configured, in which case they are
+// written below 'storage.dir' and served at mediaPath.
+func newObjectStore() objectstore.ObjectStore {
 
-	if uid == nil {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
+	backend := viper.GetString("storage.backend")
 
-	user, err := findUserByID(uid.(string))
+	log.Info("Storage backend: ", backend)
 
-	if err != nil {
-		log.Error("Could not find user:", err)
-	}
+	if backend == "local" {
+		dir := viper.GetString("storage.dir")
+		if dir == "" {
+			dir = "uploads"
+		}
+
+		local, err := objectstore.NewLocal(dir, mediaPath)
+		if err != nil {
+			log.Fatalf("Could not create storage directory %s: %v", dir, err)
+		}
 
-	scanInput := &dynamodb.ScanInput{
-		TableName: aws.String("PhotosAppPhotos"),
+		return local
 	}
 
 	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	return objectstore.NewS3(sess, bucketName)
+}
+
+// FetchAllPhotos gets all photos for all users
+// GET /explore
+func FetchAllPhotos(c *gin.Context) {
+	st := storesFrom(c)
+	user := currentUser(c)
+
+	start, err := decodeCursor(c.Query("cursor"))
 
-	so, err := svc.Scan(scanInput)
 	if err != nil {
-		log.Errorf("Error querying PhotosAppPhotos: %v", err)
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
 	}
 
-	photos := []photo{}
-	err = dynamodbattribute.UnmarshalListOfMaps(so.Items, &photos)
+	photos, next, err := st.Photos.List(start, pageSize(c))
 	if err != nil {
-		log.Errorf("failed to unmarshal Query result items, %v", err)
+		log.Errorf("Error querying PhotosAppPhotos: %v", err)
 	}
 
-	currentUser, _ := findUserByID(uid.(string))
+	photos = visiblePhotos(st, usersFrom(c), user.ID, photos)
 
 	c.HTML(http.StatusOK, "photos.html", gin.H{
+		"title":       "Explore",
 		"user":        user,
 		"photos":      photos,
-		"CurrentUser": currentUser,
+		"next":        encodeCursor(next),
+		"CurrentUser": user,
 	})
 }
 
 // FetchSinglePhoto gets a single photo by ID
 func FetchSinglePhoto(c *gin.Context) {
-	sessionStore := sessions.Default(c)
-	uid := sessionStore.Get(userKey)
+	id := c.Params.ByName("id")
 
-	if uid == nil {
+	st := storesFrom(c)
+
+	photo, err := st.Photos.Get(id)
+
+	if err == nil && photo.DeletedAt != nil {
+		err = errNotFound
+	}
+
+	if err != nil {
+		log.Errorf("Error querying single photo: %v", err)
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
 
-	id := c.Params.ByName("id")
+	log.Debug("Photo: ", photo)
 
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppPhotos"),
-		Limit:     aws.Int64(1),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"ID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(id),
-					},
-				},
-			},
-		},
-	}
+	// Load comments
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	start, err := decodeCursor(c.Query("cursor"))
 
-	qo, err := svc.Query(queryInput)
 	if err != nil {
-		fmt.Printf("Error querying single photo: %v", err)
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
 	}
 
-	photos := []photo{}
-	err = dynamodbattribute.UnmarshalListOfMaps(qo.Items, &photos)
+	comments, next, err := st.Comments.ByPhoto(photo.ID, start, pageSize(c))
+
 	if err != nil {
-		fmt.Printf("failed to unmarshal Query result items, %v", err)
+		log.Error("Could not load comments:", err)
 	}
 
-	if len(photos) == 0 {
-		c.AbortWithStatus(http.StatusNotFound)
-		return
-	}
+	// Load the author and commenters in one batch
 
-	photo := photos[0]
+	users := usersFrom(c)
 
-	log.Debug("Photo: ", photo)
+	ids := []string{photo.UserID}
+	for _, cm := range comments {
+		ids = append(ids, cm.UserID)
+	}
 
-	// Load user info
-	user, err := findUserByID(photo.UserID)
+	if err := users.Prime(ids...); err != nil {
+		log.Error("Could not load users:", err)
+	}
+
+	user, err := users.Load(photo.UserID)
 
 	if err != nil {
 		log.Error("Could not find user:", err)
+		c.AbortWithStatus(http.StatusNotFound)
+		return
 	}
 
-	// Load comments
+	if ok, err := canSeePhotos(st, currentUserID(c), user); !ok || err != nil {
+		c.HTML(http.StatusNotFound, "404.html", nil)
+		return
+	}
 
-	comments, err := findCommentsByPhoto(photo.ID)
-	currentUser, _ := findUserByID(photo.UserID)
+	viewer := currentUser(c)
 
 	c.HTML(http.StatusOK, "photo.html", gin.H{
 		"user":        user,
 		"photo":       photo,
+		"CanEdit":     canEditPhoto(st, viewer, photo) == nil,
+		"CanDelete":   canDeletePhoto(st, viewer, photo) == nil,
 		"comments":    comments,
-		"CurrentUser": currentUser,
+		"next":        encodeCursor(next),
+		"Users":       users,
+		"CurrentUser": viewer,
 	})
 }
 
-// CreatePhoto saves the file to disk, generates its thumbnails, and stores
-// metadata in the database.
-func CreatePhoto(c *gin.Context) {
+// PhotoLikes lists the users who liked a photo
+// GET /photos/:id/likes
+func PhotoLikes(c *gin.Context) {
+	st := storesFrom(c)
+	photo := authorizedPhoto(c)
 
-	sessionStore := sessions.Default(c)
-	jwt := sessionStore.Get(accessToken)
-	cog := NewCognito()
-	sub, err := cog.ValidateToken(jwt.(string))
+	start, err := decodeCursor(c.Query("cursor"))
 
 	if err != nil {
-		c.String(http.StatusBadRequest, fmt.Sprintf("Could not find user: %s", sub))
+		c.HTML(http.StatusBadRequest, "404.html", nil)
 		return
 	}
 
+	users, next, err := likers(st, photo.ID, start, pageSize(c))
+
+	if err != nil {
+		log.Error("Could not load likes:", err)
+	}
+
+	c.HTML(http.StatusOK, "likes.html", gin.H{
+		"photo":       photo,
+		"users":       users,
+		"next":        encodeCursor(next),
+		"CurrentUser": currentUser(c),
+	})
+}
+
+// CreatePhoto saves the file to disk, generates its thumbnails, and stores
+// metadata in the database.
+func CreatePhoto(c *gin.Context) {
+
+	sub := currentUserID(c)
+
+	limitUpload(c)
+
 	form, err := c.MultipartForm()
 
 	if err != nil {
-		c.String(http.StatusBadRequest, fmt.Sprintf("get form err: %s", err.Error()))
+		log.Errorf("Error uploading file %v", err)
+		c.String(formStatus(err), fmt.Sprintf("get form err: %s", err.Error()))
 		return
 	}
 
-	file, header, err := c.Request.FormFile("photofile")
+	caption := c.PostForm("caption")
+	log.Info("Caption:", caption)
+
+	photoid, err := savePhoto(storesFrom(c), sub, form.File["photofile"], caption)
 
 	if err != nil {
-		log.Errorf("Error uploading file %v", err)
+		c.String(uploadStatus(err), err.Error())
 		return
 	}
 
-	defer file.Close()
+	c.Redirect(http.StatusFound, fmt.Sprintf("/photos/%s", photoid))
+}
 
-	caption := form.Value["caption"][0]
-	log.Info("Caption:", caption)
+// savePhoto uploads the files of a post to the object store, inserts its
+// photo record and generates the thumbnails when no Lambda is watching the
+// bucket. Returns the new photo ID.
+func savePhoto(st *Stores, sub string, files []*multipart.FileHeader, caption string) (string, error) {
 
-	// Upload file to S3 bucket
+	if len(files) == 0 {
+		return "", &uploadError{http.StatusBadRequest, "No file uploaded"}
+	}
 
-	sess := session.Must(session.NewSession())
-	uploader := s3manager.NewUploader(sess)
+	if len(files) > maxPostItems {
+		return "", &uploadError{http.StatusBadRequest, fmt.Sprintf("A post can hold at most %d photos and videos", maxPostItems)}
+	}
 
-	key := sub + "/" + header.Filename
+	// Upload files to the object store
 
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		Bucket:      aws.String(bucketName),
-		Key:         aws.String(key),
-		Body:        file,
-		ContentType: aws.String(mime.TypeByExtension(filepath.Ext(header.Filename))),
-	})
+	photoid := uuid.NewV4().String()
+	items := []mediaItem{}
+
+	for i, fh := range files {
+		item := mediaItem{OriginalFilename: fh.Filename, userid: sub}
+
+		if err := uploadFile(st.Objects, fh, photoid, i, &item); err != nil {
+			log.Errorf("Unable to upload file %q, %v", fh.Filename, err)
+			removeObjects(st.Objects, items)
+
+			if _, ok := err.(*uploadError); ok {
+				return "", err
+			}
+
+			return "", fmt.Errorf("Upload file err: %s", err.Error())
+		}
+
+		log.Info("Uploaded file:", item.Filename)
+
+		// The Lambda function encodes in the same format, see thumbnailFormat
+		if !item.IsVideo() {
+			item.ThumbFormat = thumbnailFormat()
+		}
+
+		items = append(items, item)
+	}
+
+	// Insert DB record for photo and user
+
+	err := insertPhoto(st, photoid, sub, items, caption)
 
 	if err != nil {
-		log.Errorf("Unable to upload file %q, %v", header.Filename, err)
-		c.String(http.StatusBadRequest, fmt.Sprintf("Upload file err: %s", err.Error()))
-		return
+		removeObjects(st.Objects, items)
+		return "", fmt.Errorf("Insert photo err: %s", err.Error())
 	}
 
-	log.Info("Uploaded file:", header.Filename)
+	// Generate thumbnails, always for videos and images the Lambda cannot
+	// decode. Failures are noted on the items instead of failing the upload.
+
+	inline := viper.GetBool("storage.inlineThumbnails")
+	failed := false
+
+	for i, item := range items {
+		if item.ThumbnailError != "" {
+			continue
+		}
+
+		switch {
+		case item.IsVideo():
+			err = generatePoster(st.Objects, item, thumbnailSize)
+		case inline || imaging.IsExternal(item.Format):
+			err = generateThumbnail(st.Objects, item, thumbnailSize)
+		}
+
+		if err == imaging.ErrUnsupported {
+			items[i].ThumbnailError = unsupportedFormat(item.Format)
+			failed = true
+		} else if err != nil {
+			log.Errorf("Error generating thumbnail of %s: %v", item.Key(), err)
+			items[i].ThumbnailError = "The preview could not be generated"
+			failed = true
+		}
+
+		err = nil
+	}
 
-	// Insert DB record for photo and user
+	if failed {
+		if err := st.Photos.SetMedia(photoid, items); err != nil {
+			log.Errorf("failed to record thumbnail errors, %v", err)
+		}
+	}
+
+	return photoid, nil
+}
 
-	photoid, err := insertPhoto(sub, header.Filename, caption)
+// uploadFile checks the upload and stores it as the item at index i of the
+// post photoid
+func uploadFile(objects objectstore.ObjectStore, fh *multipart.FileHeader, photoid string, i int, item *mediaItem) error {
+
+	file, err := fh.Open()
 
 	if err != nil {
-		c.String(http.StatusBadRequest, fmt.Sprintf("Insert photo err: %s", err.Error()))
-		return
+		return err
 	}
 
-	// // Generate thumbnail
+	defer file.Close()
+
+	contentType, err := checkUpload(file, fh, item)
 
-	// err = generateThumbnail(sess, sub, header.Filename, key, thumbnailSize)
+	if err != nil {
+		return err
+	}
 
-	// if err != nil {
-	// 	c.String(http.StatusBadRequest, fmt.Sprintf("Error generating thumbnail: %s", err.Error()))
-	// 	return
-	// }
+	item.Filename = objectName(photoid, i, normalizedExt(contentType, fh.Filename))
 
-	c.Redirect(http.StatusFound, fmt.Sprintf("/photos/%s", photoid))
+	return objects.Put(item.Key(), file, contentType)
 }
 
-// DeletePhoto deletes a single photo by ID
-func DeletePhoto(c *gin.Context) {
+// removeObjects deletes the uploads of a post that could not be saved
+func removeObjects(objects objectstore.ObjectStore, items []mediaItem) {
+	for _, item := range items {
+		if err := objects.Delete(item.Key()); err != nil {
+			log.Errorf("failed to remove upload %s, %v", item.Key(), err)
+		}
+	}
+}
 
-	id := c.Params.ByName("id")
+// DeletePhoto moves a single photo to the trash
+func DeletePhoto(c *gin.Context) {
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	err := trashPhoto(storesFrom(c), authorizedPhoto(c).ID)
 
-	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: aws.String("PhotosAppPhotos"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"ID": {S: aws.String(id)},
-		},
-	})
+	if err == errNotFound {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
 
 	if err != nil {
-		log.Errorf("failed to delete record from DynamoDB, %v", err)
+		log.Errorf("failed to trash photo, %v", err)
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
@@ -269,45 +400,38 @@ func DeletePhoto(c *gin.Context) {
 	c.JSON(http.StatusOK, nil)
 }
 
-// LikePhoto increments the 'Likes' count
+// LikePhoto records a like of the current user
 func LikePhoto(c *gin.Context) {
 	id := c.Params.ByName("id")
 
 	log.Info("Liking photo: ", id)
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	result, err := svc.UpdateItem(&dynamodb.UpdateItemInput{
-		TableName: aws.String("PhotosAppPhotos"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"ID": {S: aws.String(id)},
-		},
-		UpdateExpression: aws.String("set Likes = Likes + :num"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":num": {
-				N: aws.String("1"),
-			},
-		},
-		ReturnValues: aws.String("UPDATED_NEW"),
-	})
+	likes, err := likePhoto(storesFrom(c), id, currentUserID(c))
 
 	if err != nil {
-		log.Errorf("failed to increment PhotosAppPhotos Likes, %v", err)
+		log.Errorf("failed to like photo, %v", err)
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
 
-	photo := photo{}
-	err = dynamodbattribute.UnmarshalMap(result.Attributes, &photo)
+	c.JSON(http.StatusOK, gin.H{"likes": likes, "liked": true})
+}
+
+// UnlikePhoto removes the like of the current user
+func UnlikePhoto(c *gin.Context) {
+	id := c.Params.ByName("id")
+
+	log.Info("Unliking photo: ", id)
+
+	likes, err := unlikePhoto(storesFrom(c), id, currentUserID(c))
 
 	if err != nil {
-		log.Errorf("Unable to unmarshal response, %v", err)
+		log.Errorf("failed to unlike photo, %v", err)
 		c.JSON(http.StatusInternalServerError, nil)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"likes": photo.Likes})
+	c.JSON(http.StatusOK, gin.H{"likes": likes, "liked": false})
 }
 
 // CommentPhoto adds a comment to a photo
@@ -319,116 +443,112 @@ func CommentPhoto(c *gin.Context) {
 		Comment string `json:"comment"`
 	}
 
-	if err := c.BindJSON(&comment); err != nil {
-		log.Error("BindJSON error:", err.Error())
+	if err := c.ShouldBindJSON(&comment); err != nil || comment.Comment == "" {
+		c.JSON(http.StatusBadRequest, nil)
+		return
 	}
 
 	log.Printf("Comment: %v\n", comment.Comment)
 
-	sessionStore := sessions.Default(c)
-	uid := sessionStore.Get(userKey)
-	err := insertComment(id, uid.(string), comment.Comment)
+	_, err := insertComment(storesFrom(c), id, currentUserID(c), comment.Comment)
 
 	if err != nil {
 		log.Error("Error inserting comment:", err.Error())
+		c.JSON(http.StatusInternalServerError, nil)
+		return
 	}
 
-	user, _ := findUserByID(uid.(string))
-
-	c.JSON(http.StatusOK, gin.H{"username": user.Username})
+	c.JSON(http.StatusOK, gin.H{"username": currentUser(c).Username})
 }
 
 // Insert photo record into database
-func insertPhoto(uid string, fn string, caption string) (string, error) {
-
-	id := uuid.NewV4().String()
+func insertPhoto(st *Stores, id string, uid string, items []mediaItem, caption string) error {
 
 	photo := &photo{
 		ID:        id,
 		UserID:    uid,
-		Filename:  fn,
+		Filename:  items[0].Filename,
+		Media:     items,
 		Caption:   caption,
 		CreatedAt: time.Now(),
 	}
 
-	av, err := dynamodbattribute.MarshalMap(photo)
-
-	if err != nil {
-		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+	if err := st.Photos.Put(photo); err != nil {
+		log.Errorf("failed to put photo record, %v", err)
+		return err
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	_, err = svc.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("PhotosAppPhotos"),
-		Item:      av,
-	})
+	log.Info("Inserted photo record:", id)
 
-	if err != nil {
-		log.Errorf("failed to put Record to DynamoDB, %v", err)
+	if err := publishToTimelines(st, photo); err != nil {
+		log.Errorf("failed to publish photo to timelines, %v", err)
 	}
 
-	log.Info("Inserted photo record:", id)
-
-	return id, nil
+	return nil
 }
 
-func generateThumbnail(sess *session.Session, sub string, filename string, key string, maxWidth uint) error {
+// purgePhotoJob is the job kind that runs purgePhoto
+const purgePhotoJob = "purgePhoto"
 
-	log.Infof("Fetching s3://%v/%v", bucketName, key)
+// deletePhoto deletes the photo for good, see trashPhoto for the reversible
+// delete. It removes the photo record and queues a job removing everything
+// else that belongs to it. The job is stored first so nothing is orphaned if
+// the process dies in between; it deletes the record too if this fails.
+func deletePhoto(st *Stores, id string) error {
 
-	buff := &aws.WriteAtBuffer{}
-	s3dl := s3manager.NewDownloader(sess)
-	_, err := s3dl.Download(buff, &s3.GetObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(key),
-	})
+	photo, err := st.Photos.Get(id)
 
 	if err != nil {
-		log.Fatalf("Could not download from S3: %v", err)
+		return err
 	}
 
-	log.Infof("Decoding image")
+	if err := enqueueJob(st, purgePhotoJob, photo); err != nil {
+		return err
+	}
 
-	imageBytes := buff.Bytes()
-	reader := bytes.NewReader(imageBytes)
+	return st.Photos.Delete(id)
+}
 
-	img, err := jpeg.Decode(reader)
-	if err != nil {
-		log.Fatalf("bad response: %s", err)
-	}
+// purgePhoto removes the record, timeline entries, likes, comments and
+// objects of a deleted photo. payload is the photo as JSON. Every step can
+// be repeated, so a failed job simply runs again from the start.
+func purgePhoto(st *Stores, payload string) error {
 
-	log.Infof("Generating thumbnail")
-	thumbnail := resize.Thumbnail(maxWidth, maxWidth, img, resize.Lanczos3)
+	p := &photo{}
 
-	log.Infof("Encoding image for upload to S3")
-	buf := new(bytes.Buffer)
-	err = jpeg.Encode(buf, thumbnail, nil)
+	if err := json.Unmarshal([]byte(payload), p); err != nil {
+		return err
+	}
 
-	if err != nil {
-		log.Errorf("JPEG encoding error: %v", err)
+	if err := st.Photos.Delete(p.ID); err != nil && err != errNotFound {
 		return err
 	}
 
-	thumbkey := sub + "/thumb/" + filename
+	if err := retractFromTimelines(st, p); err != nil {
+		return err
+	}
 
-	log.Infof("Preparing S3 object: %s", thumbkey)
+	if err := st.Likes.DeleteByPhoto(p.ID); err != nil {
+		return err
+	}
 
-	uploader := s3manager.NewUploader(sess)
-	result, err := uploader.Upload(&s3manager.UploadInput{
-		Body:        bytes.NewReader(buf.Bytes()),
-		Bucket:      aws.String(bucketName),
-		Key:         aws.String(thumbkey),
-		ContentType: aws.String(mime.TypeByExtension(filepath.Ext(filename))),
-	})
+	if err := st.Comments.DeleteByPhoto(p.ID); err != nil {
+		return err
+	}
 
-	if err != nil {
-		log.Error("Failed to upload", err)
+	if err := st.Edits.DeleteByPhoto(p.ID); err != nil {
 		return err
 	}
 
-	log.Println("Successfully uploaded to", result.Location)
+	for _, item := range p.Items() {
+		for _, key := range []string{item.ThumbKey(), item.Key()} {
+			if err := st.Objects.Delete(key); err != nil && err != objectstore.ErrNotFound {
+				return err
+			}
+		}
+	}
+
+	log.Infof("Purged photo %s", p.ID)
 
 	return nil
 }
@@ -436,3 +556,66 @@ func generateThumbnail(sess *session.Session, sub string, filename string, key s
 func (p *photo) TimeAgo() string {
 	return humanize.Time(p.CreatedAt)
 }
+
+// Key returns the object key of the original upload of the cover
+func (p *photo) Key() string {
+	return p.Items()[0].Key()
+}
+
+// ThumbKey returns the object key of the thumbnail of the cover
+func (p *photo) ThumbKey() string {
+	return p.Items()[0].ThumbKey()
+}
+
+// Cover is the item shown in grids
+func (p *photo) Cover() mediaItem {
+	return p.Items()[0]
+}
+
+// HasVideo reports whether any item of the post is a video
+func (p *photo) HasVideo() bool {
+	for _, item := range p.Media {
+		if item.IsVideo() {
+			return true
+		}
+	}
+	return false
+}
+
+// Items returns the images and videos of the post in order
+func (p *photo) Items() []mediaItem {
+
+	items := p.Media
+	if len(items) == 0 {
+		items = []mediaItem{{Filename: p.Filename}}
+	}
+
+	out := make([]mediaItem, 0, len(items))
+	for _, item := range items {
+		item.userid = p.UserID
+		out = append(out, item)
+	}
+
+	return out
+}
+
+// Key returns the object key of the original upload
+func (m mediaItem) Key() string {
+	return m.userid + "/" + m.Filename
+}
+
+// ThumbKey returns the object key of the thumbnail, the JPEG poster frame
+// for videos. Its extension matches the format the thumbnail is encoded in,
+// except for images from before ThumbFormat.
+func (m mediaItem) ThumbKey() string {
+
+	if m.IsVideo() {
+		return m.userid + "/thumb/" + m.Filename + ".jpg"
+	}
+
+	if m.ThumbFormat == "" {
+		return m.userid + "/thumb/" + m.Filename
+	}
+
+	return m.userid + "/thumb/" + strings.TrimSuffix(m.Filename, path.Ext(m.Filename)) + imaging.Extension(m.ThumbFormat)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// errForbidden is returned when a policy denies an action
+var errForbidden = errors.New("You are not allowed to do this")
+
+// errSelf is returned for follows, blocks and mutes of one's own account
+var errSelf = errors.New("You cannot do this to your own account")
+
+const photoKey = "photo"
+
+// photoPolicy decides whether u may act on p. It returns nil to allow,
+// errForbidden to deny, errNotFound to hide the photo altogether,
+// or a store error.
+type photoPolicy func(st *Stores, u *user, p *photo) error
+
+// userPolicy decides whether u may act on the account target
+type userPolicy func(st *Stores, u *user, target *user) error
+
+// isAdmin reports whether u is listed in 'admin.users'
+func isAdmin(u *user) bool {
+	for _, name := range viper.GetStringSlice("admin.users") {
+		if name == u.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// canViewPhoto allows whoever may see the owner's photos, as long as the
+// photo is not in the trash
+func canViewPhoto(st *Stores, u *user, p *photo) error {
+
+	if p.DeletedAt != nil {
+		return errNotFound
+	}
+
+	owner, err := st.Users.FindByID(p.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	ok, err := canSeePhotos(st, u.ID, owner)
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errNotFound
+	}
+
+	return nil
+}
+
+// canInteractWithPhoto allows likes and comments by everyone who can view
+// the photo; users the owner blocked already cannot
+func canInteractWithPhoto(st *Stores, u *user, p *photo) error {
+	return canViewPhoto(st, u, p)
+}
+
+// canDeletePhoto allows the owner only
+func canDeletePhoto(st *Stores, u *user, p *photo) error {
+
+	if p.UserID != u.ID {
+		return errForbidden
+	}
+
+	if p.DeletedAt != nil {
+		return errNotFound
+	}
+
+	return nil
+}
+
+// canRestorePhoto allows the owner to take a photo out of the trash
+func canRestorePhoto(st *Stores, u *user, p *photo) error {
+
+	if p.UserID != u.ID {
+		return errForbidden
+	}
+
+	if p.DeletedAt == nil {
+		return errNotFound
+	}
+
+	return nil
+}
+
+// canEditPhoto allows the owner and admins
+func canEditPhoto(st *Stores, u *user, p *photo) error {
+
+	if p.UserID != u.ID && !isAdmin(u) {
+		return errForbidden
+	}
+
+	if p.DeletedAt != nil {
+		return errNotFound
+	}
+
+	return nil
+}
+
+// canFollow allows following other users unless either blocked the other
+func canFollow(st *Stores, u *user, target *user) error {
+
+	if err := notSelf(st, u, target); err != nil {
+		return err
+	}
+
+	blocked, err := isBlocked(st, target.ID, u.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		return errBlocked
+	}
+
+	return nil
+}
+
+// notSelf allows acting on any account but one's own
+func notSelf(st *Stores, u *user, target *user) error {
+
+	if u.ID == target.ID {
+		return errSelf
+	}
+
+	return nil
+}
+
+// authorizePhoto loads the photo named by the 'id' parameter and applies the
+// policy for the current user. Handlers get the photo with authorizedPhoto.
+func authorizePhoto(policy photoPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := storesFrom(c)
+
+		p, err := st.Photos.Get(c.Param("id"))
+
+		if err == nil {
+			err = policy(st, currentUser(c), p)
+		}
+
+		if err != nil {
+			deny(c, err, "Photo")
+			return
+		}
+
+		c.Set(photoKey, p)
+		c.Next()
+	}
+}
+
+// authorizeUser loads the user named by the 'id' parameter and applies the
+// policy for the current user
+func authorizeUser(policy userPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+
+		target, err := usersFrom(c).Load(c.Param("id"))
+
+		if err == nil {
+			err = policy(storesFrom(c), currentUser(c), target)
+		}
+
+		if err != nil {
+			deny(c, err, "User")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authorizedPhoto returns the photo loaded by authorizePhoto
+func authorizedPhoto(c *gin.Context) *photo {
+	return c.MustGet(photoKey).(*photo)
+}
+
+// deny aborts with 403 for denied actions, 400 for actions on one's own
+// account, 404 for hidden or missing records and 500 otherwise, as an API
+// error on /api/ paths
+func deny(c *gin.Context, err error, what string) {
+
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		if err == errForbidden {
+			apiError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		apiStoreError(c, err, what)
+		return
+	}
+
+	switch err {
+	case errForbidden, errBlocked:
+		c.AbortWithStatusJSON(http.StatusForbidden, nil)
+	case errSelf:
+		c.AbortWithStatusJSON(http.StatusBadRequest, nil)
+	case errNotFound:
+		c.AbortWithStatusJSON(http.StatusNotFound, nil)
+	default:
+		log.Errorf("Error authorizing request: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, nil)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// policyFixture creates the accounts the policies are tested with: alice
+// with a public and bob with a private account, carol following bob, dave
+// blocked by both of them, erin a stranger and the admin root.
+func policyFixture(t *testing.T) (*Stores, map[string]*user) {
+
+	viper.Set("admin.users", []string{"root"})
+	t.Cleanup(func() { viper.Set("admin.users", nil) })
+
+	st := NewMemoryStores()
+
+	users := map[string]*user{}
+
+	for _, name := range []string{"alice", "bob", "carol", "dave", "erin", "root"} {
+		u := &user{ID: name + "-id", Username: name, Private: name == "bob"}
+
+		if err := st.Users.Put(u); err != nil {
+			t.Fatal(err)
+		}
+
+		users[name] = u
+	}
+
+	if err := st.Followers.Put(&follower{UserID: "bob-id", FollowerID: "carol-id"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, owner := range []string{"alice-id", "bob-id"} {
+		if err := st.Blocks.Put(&relation{UserID: owner, OtherID: "dave-id", CreatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return st, users
+}
+
+func TestPhotoPolicies(t *testing.T) {
+
+	st, users := policyFixture(t)
+
+	deleted := time.Now()
+
+	public := &photo{ID: "public", UserID: "alice-id"}
+	private := &photo{ID: "private", UserID: "bob-id"}
+	trashed := &photo{ID: "trashed", UserID: "alice-id", DeletedAt: &deleted}
+
+	tests := []struct {
+		name   string
+		policy photoPolicy
+		user   string
+		photo  *photo
+		want   error
+	}{
+		{"view own", canViewPhoto, "alice", public, nil},
+		{"view public", canViewPhoto, "erin", public, nil},
+		{"view public blocked", canViewPhoto, "dave", public, errNotFound},
+		{"view private own", canViewPhoto, "bob", private, nil},
+		{"view private follower", canViewPhoto, "carol", private, nil},
+		{"view private non-follower", canViewPhoto, "erin", private, errNotFound},
+		{"view private admin", canViewPhoto, "root", private, errNotFound},
+		{"view trashed own", canViewPhoto, "alice", trashed, errNotFound},
+
+		{"interact own", canInteractWithPhoto, "alice", public, nil},
+		{"interact public", canInteractWithPhoto, "erin", public, nil},
+		{"interact blocked", canInteractWithPhoto, "dave", public, errNotFound},
+		{"interact private follower", canInteractWithPhoto, "carol", private, nil},
+		{"interact private non-follower", canInteractWithPhoto, "erin", private, errNotFound},
+		{"interact trashed", canInteractWithPhoto, "erin", trashed, errNotFound},
+
+		{"delete own", canDeletePhoto, "alice", public, nil},
+		{"delete stranger", canDeletePhoto, "erin", public, errForbidden},
+		{"delete admin", canDeletePhoto, "root", public, errForbidden},
+		{"delete trashed", canDeletePhoto, "alice", trashed, errNotFound},
+
+		{"restore own", canRestorePhoto, "alice", trashed, nil},
+		{"restore stranger", canRestorePhoto, "erin", trashed, errForbidden},
+		{"restore admin", canRestorePhoto, "root", trashed, errForbidden},
+		{"restore not trashed", canRestorePhoto, "alice", public, errNotFound},
+
+		{"edit own", canEditPhoto, "alice", public, nil},
+		{"edit admin", canEditPhoto, "root", private, nil},
+		{"edit stranger", canEditPhoto, "erin", public, errForbidden},
+		{"edit blocked", canEditPhoto, "dave", public, errForbidden},
+		{"edit trashed own", canEditPhoto, "alice", trashed, errNotFound},
+		{"edit trashed admin", canEditPhoto, "root", trashed, errNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy(st, users[tt.user], tt.photo); err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserPolicies(t *testing.T) {
+
+	st, users := policyFixture(t)
+
+	tests := []struct {
+		name   string
+		policy userPolicy
+		user   string
+		target string
+		want   error
+	}{
+		{"follow public", canFollow, "erin", "alice", nil},
+		{"follow private", canFollow, "erin", "bob", nil},
+		{"follow self", canFollow, "alice", "alice", errSelf},
+		{"follow blocker", canFollow, "dave", "alice", errBlocked},
+		{"follow blocked", canFollow, "alice", "dave", errBlocked},
+		{"follow admin", canFollow, "root", "bob", nil},
+
+		{"not self other", notSelf, "erin", "alice", nil},
+		{"not self blocked", notSelf, "dave", "alice", nil},
+		{"not self own", notSelf, "alice", "alice", errSelf},
+		{"not self admin", notSelf, "root", "root", errSelf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy(st, users[tt.user], users[tt.target]); err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
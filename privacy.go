@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// followRequest is a pending follow of a private account
+type followRequest struct {
+	UserID     string // the private account
+	FollowerID string
+	CreatedAt  time.Time
+}
+
+// canSeePhotos reports whether viewerid may see the photos of owner: their
+// own, those of public accounts and those of private accounts they follow,
+// unless the owner blocked them
+func canSeePhotos(st *Stores, viewerid string, owner *user) (bool, error) {
+
+	if owner.ID == viewerid {
+		return true, nil
+	}
+
+	if blocked, err := st.Blocks.Exists(owner.ID, viewerid); err != nil || blocked {
+		return false, err
+	}
+
+	if !owner.Private {
+		return true, nil
+	}
+
+	return st.Followers.Exists(owner.ID, viewerid)
+}
+
+// visiblePhotos drops the photos viewerid may not see
+func visiblePhotos(st *Stores, users *userLoader, viewerid string, photos []photo) []photo {
+
+	ids := make([]string, 0, len(photos))
+	for _, p := range photos {
+		ids = append(ids, p.UserID)
+	}
+
+	if err := users.Prime(ids...); err != nil {
+		log.Errorf("Error loading photo owners: %v", err)
+	}
+
+	allowed := map[string]bool{}
+	visible := []photo{}
+
+	for _, p := range photos {
+		ok, seen := allowed[p.UserID]
+
+		if !seen {
+			if owner, err := users.Load(p.UserID); err == nil {
+				ok, err = canSeePhotos(st, viewerid, owner)
+				if err != nil {
+					log.Errorf("Error checking follower: %v", err)
+				}
+			}
+			allowed[p.UserID] = ok
+		}
+
+		if ok {
+			visible = append(visible, p)
+		}
+	}
+
+	return visible
+}
+
+// setPrivate changes the privacy of an account. Making it public approves
+// all pending requests.
+func setPrivate(st *Stores, userid string, private bool) error {
+
+	if err := st.Users.SetPrivate(userid, private); err != nil {
+		return err
+	}
+
+	if private {
+		return nil
+	}
+
+	for {
+		requests, _, err := st.Requests.ByUser(userid, nil, maxPageSize)
+
+		if err != nil {
+			return err
+		}
+
+		if len(requests) == 0 {
+			return nil
+		}
+
+		for _, r := range requests {
+			if err := approveFollowRequest(st, userid, r.FollowerID); err != nil && err != errNotFound {
+				return err
+			}
+		}
+	}
+}
+
+// approveFollowRequest turns the request of followerid into a follow
+func approveFollowRequest(st *Stores, userid string, followerid string) error {
+
+	if err := st.Requests.Delete(userid, followerid); err != nil {
+		return err
+	}
+
+	return addFollower(st, userid, followerid)
+}
+
+// rejectFollowRequest drops the request of followerid
+func rejectFollowRequest(st *Stores, userid string, followerid string) error {
+	return st.Requests.Delete(userid, followerid)
+}
+
+// requestsPage returns a page of the users asking to follow userid
+func requestsPage(st *Stores, userid string, start pageKey, limit int) ([]user, pageKey, error) {
+
+	requests, next, err := st.Requests.ByUser(userid, start, limit)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]string, 0, len(requests))
+	for _, r := range requests {
+		ids = append(ids, r.FollowerID)
+	}
+
+	users, err := st.Users.FindMany(ids)
+
+	return users, next, err
+}
+
+// Settings shows the privacy settings and pending follow requests
+// GET /settings
+func Settings(c *gin.Context) {
+
+	st := storesFrom(c)
+	user := currentUser(c)
+
+	start, err := decodeCursor(c.Query("cursor"))
+
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
+	}
+
+	requests, next, err := requestsPage(st, user.ID, start, pageSize(c))
+
+	if err != nil {
+		log.Errorf("Error loading follow requests: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "settings.html", gin.H{
+		"title":       "Settings",
+		"user":        user,
+		"requests":    requests,
+		"next":        encodeCursor(next),
+		"CurrentUser": user,
+	})
+}
+
+// SaveSettings updates the privacy settings
+// POST /settings
+func SaveSettings(c *gin.Context) {
+
+	private := c.PostForm("private") == "on"
+
+	if err := setPrivate(storesFrom(c), currentUserID(c), private); err != nil {
+		log.Errorf("failed to update settings, %v", err)
+		c.HTML(http.StatusInternalServerError, "404.html", nil)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/settings")
+}
+
+// ApproveFollowRequest accepts a pending follow
+// POST /settings/requests/:id/approve
+func ApproveFollowRequest(c *gin.Context) {
+	respondToFollowRequest(c, approveFollowRequest)
+}
+
+// RejectFollowRequest declines a pending follow
+// POST /settings/requests/:id/reject
+func RejectFollowRequest(c *gin.Context) {
+	respondToFollowRequest(c, rejectFollowRequest)
+}
+
+func respondToFollowRequest(c *gin.Context, respond func(st *Stores, userid string, followerid string) error) {
+
+	err := respond(storesFrom(c), currentUserID(c), c.Params.ByName("id"))
+
+	if err == errNotFound {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to answer follow request, %v", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
@@ -9,12 +9,13 @@ $(function () {
 
     $("span.img-action.heart").click(function (e) {
         var id = $(this).data("id");
-        $(this).find(">:first-child").addClass("redClass");
+        var heart = $(this).find(">:first-child");
 
         $.ajax({
             url: `/photos/${id}/like`,
-            type: 'POST'
+            type: heart.hasClass("redClass") ? 'DELETE' : 'POST'
         }).done(function (data) {
+            heart.toggleClass("redClass", data.liked);
             $("#likeCount").text(data.likes + " likes")
         }).fail(function (jqXHR, textStatus) {
             console.log("An error occurred: " + textStatus);
@@ -29,7 +30,7 @@ $(function () {
 
     $("span.img-action.trash").click(function (e) {
         e.preventDefault();
-        if (window.confirm("Are you sure?")) {
+        if (window.confirm("Delete this photo? You can restore it from Recently deleted in your settings.")) {
             var id = $(this).data("id");
 
             $.ajax({
@@ -43,6 +44,51 @@ $(function () {
         }
     });
 
+    $(document).on("click", "button.restore", function (e) {
+        var button = $(this);
+        var id = button.data("id");
+
+        $.ajax({
+            url: `/photos/${id}/restore`,
+            type: 'POST'
+        }).done(function (data) {
+            button.closest(".deleted-row").remove();
+        }).fail(function (jqXHR, textStatus) {
+            console.log("An error occurred: " + textStatus);
+        });
+    });
+
+    $("span.img-action.edit").click(function (e) {
+        e.preventDefault();
+        var edit = $(this);
+        var caption = window.prompt("Edit caption", $("#photo-caption").text());
+
+        if (caption === null) {
+            return;
+        }
+
+        $.ajax({
+            url: `/photos/${edit.data("id")}`,
+            type: 'PATCH',
+            dataType: 'json',
+            data: JSON.stringify({ caption: caption, version: edit.data("version") })
+        }).done(function (data) {
+            $("#photo-caption").text(data.caption);
+            $("#photo-edited").show();
+            edit.data("version", data.version);
+        }).fail(function (jqXHR, textStatus) {
+            if (jqXHR.status == 409) {
+                var data = jqXHR.responseJSON;
+                $("#photo-caption").text(data.caption);
+                $("#photo-edited").show();
+                edit.data("version", data.version);
+                window.alert("The caption was changed in the meantime. Check it and try again.");
+                return;
+            }
+            console.log("An error occurred: " + textStatus);
+        });
+    });
+
     $("input.comment").keypress(function (e) {
         var id = $(this).data("id");
         var input = $(this)
@@ -52,10 +98,10 @@ $(function () {
                 url: `/photos/${id}/comment`,
                 type: 'POST',
                 dataType: 'json',
-                data: '{"comment": "' + comment + '"}'
+                data: JSON.stringify({comment: comment})
             }).done(function (data) {
                 console.log("Posted comment: " + comment);
-                $("#photoBody").append('<p><b>' + data.username + '</b>&nbsp;<span class="text-muted">' + comment + '</span></p>');
+                $("#comments").prepend($('<p>').append($('<b>').text(data.username), '&nbsp;', $('<span class="text-muted">').text(comment)));
                 input.val("")
             }).fail(function (jqXHR, textStatus) {
                 console.log("An error occurred: " + textStatus);
@@ -63,6 +109,25 @@ $(function () {
         }
     });
 
+    $(document).on("click", "a.load-more", function (e) {
+        e.preventDefault();
+        var link = $(this);
+        var target = link.data("target");
+
+        $.get(link.attr("href")).done(function (html) {
+            var page = $("<div>").html(html);
+            $(target).append(page.find(target).children());
+            var more = page.find("a.load-more[data-target='" + target + "']");
+            if (more.length) {
+                link.attr("href", more.attr("href"));
+            } else {
+                link.closest(".loadmore").remove();
+            }
+        }).fail(function (jqXHR, textStatus) {
+            console.log("An error occurred: " + textStatus);
+        });
+    });
+
     $("#follow").click(function (e) {
         var id = $(this).data("id");
         var followbtn = $(this)
@@ -72,14 +137,76 @@ $(function () {
             type: 'POST'
         }).done(function (data) {
             $(followbtn).hide()
-            $("#unfollow").show()
+            $(data.requested ? "#requested" : "#unfollow").show()
+        }).fail(function (jqXHR, textStatus) {
+            console.log("An error occurred: " + textStatus);
+        });
+
+    });
+
+    $(document).on("click", ".follow-row button", function (e) {
+        var button = $(this);
+        var id = button.data("id");
+        var action = button.hasClass("follow") ? "follow" : "unfollow";
+
+        $.ajax({
+            url: `/user/${id}/${action}`,
+            type: 'POST'
+        }).done(function (data) {
+            var next = "button.follow";
+            if (action == "follow") {
+                next = data.requested ? "button.requested" : "button.unfollow:not(.requested)";
+            }
+            button.hide();
+            button.siblings(next).show();
+        }).fail(function (jqXHR, textStatus) {
+            console.log("An error occurred: " + textStatus);
+        });
+
+    });
+
+    $(document).on("click", ".request-row button", function (e) {
+        var button = $(this);
+        var id = button.data("id");
+        var action = button.hasClass("approve") ? "approve" : "reject";
+
+        $.ajax({
+            url: `/settings/requests/${id}/${action}`,
+            type: 'POST'
+        }).done(function (data) {
+            button.closest(".request-row").remove();
+        }).fail(function (jqXHR, textStatus) {
+            console.log("An error occurred: " + textStatus);
+        });
+
+    });
+
+    $(document).on("click", "button.relation-action", function (e) {
+        var button = $(this);
+        var id = button.data("id");
+        var action = button.data("action");
+
+        if (action == "block" && !window.confirm("Block this user? You will stop following each other.")) {
+            return;
+        }
+
+        $.ajax({
+            url: `/user/${id}/${action}`,
+            type: 'POST'
+        }).done(function (data) {
+            var row = button.closest(".relation-row");
+            if (row.length) {
+                row.remove();
+            } else {
+                window.location.reload();
+            }
         }).fail(function (jqXHR, textStatus) {
             console.log("An error occurred: " + textStatus);
         });
 
     });
 
-    $("#unfollow").click(function (e) {
+    $("#unfollow, #requested").click(function (e) {
         var id = $(this).data("id");
         var unfollowbtn = $(this)
 
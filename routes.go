@@ -1,28 +1,39 @@
 package main
 
 import (
+	"html/template"
 	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"github.com/zoharngo/insta.git/objectstore"
 )
 
-func registerRoutes() *gin.Engine {
+func registerRoutes(st *Stores, idp IdentityProvider) *gin.Engine {
 
 	log.Info("Registering routes")
 
 	r := gin.Default()
 	store := cookie.NewStore([]byte("viErkShjgQP59tgelRXsILXNEarwRA6p"))
 	r.Use(sessions.Sessions("photos-session", store))
+	r.Use(withStores(st))
+	r.Use(withUserLoader())
+	r.Use(withIdentity(idp))
 
 	r.NoRoute(noroute)
 
+	r.SetFuncMap(templateFuncs(st))
 	r.LoadHTMLGlob("templates/**/*.html")
 
 	r.Static("/public", "./public")
 
+	if local, ok := st.Objects.(*objectstore.Local); ok {
+		r.Static(mediaPath, local.Root())
+	}
+
 	r.GET("/", home)
 
 	r.GET("/login", loginForm)
@@ -35,18 +46,42 @@ func registerRoutes() *gin.Engine {
 	user := r.Group("/user", AuthRequired())
 	{
 		user.GET("/:username", Profile)
-		user.POST("/:id/follow", Follow)
-		user.POST("/:id/unfollow", Unfollow)
+		user.GET("/:username/followers", Followers)
+		user.GET("/:username/following", Following)
+		user.POST("/:id/follow", authorizeUser(canFollow), Follow)
+		user.POST("/:id/unfollow", authorizeUser(notSelf), Unfollow)
+		user.POST("/:id/block", authorizeUser(notSelf), Block)
+		user.POST("/:id/unblock", authorizeUser(notSelf), Unblock)
+		user.POST("/:id/mute", authorizeUser(notSelf), Mute)
+		user.POST("/:id/unmute", authorizeUser(notSelf), Unmute)
+	}
+
+	r.GET("/explore", AuthRequired(), FetchAllPhotos)
+
+	settings := r.Group("/settings", AuthRequired())
+	{
+		settings.GET("/", Settings)
+		settings.POST("/", SaveSettings)
+		settings.GET("/deleted", RecentlyDeleted)
+		settings.GET("/blocked", BlockedSettings)
+		settings.POST("/requests/:id/approve", ApproveFollowRequest)
+		settings.POST("/requests/:id/reject", RejectFollowRequest)
 	}
 
+	registerAPIRoutes(r)
+
 	photos := r.Group("/photos", AuthRequired())
 	{
 		photos.POST("/", CreatePhoto)
-		photos.GET("/", FetchAllPhotos)
+		photos.GET("/", Feed)
 		photos.GET("/:id", FetchSinglePhoto)
-		photos.DELETE("/:id", DeletePhoto)
-		photos.POST("/:id/like", LikePhoto)
-		photos.POST("/:id/comment", CommentPhoto)
+		photos.PATCH("/:id", authorizePhoto(canEditPhoto), EditPhoto)
+		photos.DELETE("/:id", authorizePhoto(canDeletePhoto), DeletePhoto)
+		photos.POST("/:id/restore", authorizePhoto(canRestorePhoto), RestorePhoto)
+		photos.GET("/:id/likes", authorizePhoto(canViewPhoto), PhotoLikes)
+		photos.POST("/:id/like", authorizePhoto(canInteractWithPhoto), LikePhoto)
+		photos.DELETE("/:id/like", authorizePhoto(canViewPhoto), UnlikePhoto)
+		photos.POST("/:id/comment", authorizePhoto(canInteractWithPhoto), CommentPhoto)
 	}
 
 	return r
@@ -58,7 +93,7 @@ func home(c *gin.Context) {
 
 	if u != nil {
 		log.Debugf("user: %v", u)
-		user, err := findUserByID(u.(string))
+		user, err := usersFrom(c).Load(u.(string))
 
 		if err != nil {
 			log.Error("Error getting user:", err.Error())
@@ -74,5 +109,75 @@ func home(c *gin.Context) {
 }
 
 func noroute(c *gin.Context) {
+	if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		apiError(c, http.StatusNotFound, "Not found")
+		return
+	}
 	c.HTML(http.StatusNotFound, "404.html", nil)
 }
+
+// templateFuncs exposes store lookups that the views need while rendering
+func templateFuncs(st *Stores) template.FuncMap {
+	return template.FuncMap{
+		"follows": func(u *user, userid string) bool {
+			if u == nil {
+				return false
+			}
+			ok, err := st.Followers.Exists(userid, u.ID)
+			if err != nil {
+				log.Errorf("Error getting follows count: %v", err)
+			}
+			return ok
+		},
+		"liked": func(u *user, photoid string) bool {
+			if u == nil {
+				return false
+			}
+			ok, err := st.Likes.Exists(photoid, u.ID)
+			if err != nil {
+				log.Errorf("Error getting like: %v", err)
+			}
+			return ok
+		},
+		"requested": func(u *user, userid string) bool {
+			if u == nil {
+				return false
+			}
+			ok, err := st.Requests.Exists(userid, u.ID)
+			if err != nil {
+				log.Errorf("Error getting follow request: %v", err)
+			}
+			return ok
+		},
+		"blocks": func(u *user, userid string) bool {
+			if u == nil {
+				return false
+			}
+			ok, err := st.Blocks.Exists(u.ID, userid)
+			if err != nil {
+				log.Errorf("Error getting block: %v", err)
+			}
+			return ok
+		},
+		"mutes": func(u *user, userid string) bool {
+			if u == nil {
+				return false
+			}
+			ok, err := st.Mutes.Exists(u.ID, userid)
+			if err != nil {
+				log.Errorf("Error getting mute: %v", err)
+			}
+			return ok
+		},
+		"dict": func(kv ...interface{}) map[string]interface{} {
+			m := map[string]interface{}{}
+			for i := 0; i+1 < len(kv); i += 2 {
+				m[kv[i].(string)] = kv[i+1]
+			}
+			return m
+		},
+		"mediaURL": func(key string) string {
+			return st.Objects.URL(key)
+		},
+	}
+}
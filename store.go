@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/zoharngo/insta.git/objectstore"
+)
+
+// errNotFound is returned by the stores when a record does not exist.
+var errNotFound = errors.New("Record not found")
+
+// errExists is returned by the stores when a record to add already exists.
+var errExists = errors.New("Record already exists")
+
+// errConflict is returned by the stores when a conditional update finds that
+// the record was changed concurrently.
+var errConflict = errors.New("Record was changed by someone else")
+
+// timestampLayout is RFC 3339 in UTC with all nine fractional digits.
+// time.RFC3339Nano drops trailing zeros, so "05.1Z" would sort after
+// "05.123Z"; timestamps stored or compared as strings use this layout.
+const timestampLayout = "2006-01-02T15:04:05.000000000Z"
+
+// timestamp formats t with timestampLayout
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// UserStore persists user accounts.
+type UserStore interface {
+	FindByID(id string) (*user, error)
+	FindByUsername(username string) (*user, error)
+	// FindMany returns the users with the given IDs in the same order,
+	// skipping the ones that do not exist.
+	FindMany(ids []string) ([]user, error)
+	// List returns a page of all users in no particular order.
+	List(start pageKey, limit int) ([]user, pageKey, error)
+	Put(u *user) error
+	// SetCounts overwrites the counters of the user, see recount.
+	SetCounts(id string, photos uint, followers uint, following uint) error
+	SetPrivate(id string, private bool) error
+	// RevokeTokens increments the TokenVersion of the user, invalidating the
+	// tokens issued so far by the local identity provider.
+	RevokeTokens(id string) error
+}
+
+// PhotoStore persists photo metadata.
+type PhotoStore interface {
+	Get(id string) (*photo, error)
+	// GetMany returns the photos with the given IDs in the same order,
+	// skipping the ones that do not exist.
+	GetMany(ids []string) ([]photo, error)
+	// Put creates the photo and increments the owner's PhotoCount in the
+	// same transaction. Returns errExists if the ID is taken.
+	Put(p *photo) error
+	// Delete removes the photo and, unless it is trashed, decrements the
+	// owner's PhotoCount in the same transaction. Returns errNotFound if
+	// there is no such photo.
+	Delete(id string) error
+	// Trash sets DeletedAt and decrements the owner's PhotoCount in the same
+	// transaction; Restore undoes it. Both return errNotFound if there is no
+	// such photo or it already is in that state. The listings below skip
+	// trashed photos, Get and GetMany return them.
+	Trash(id string, at time.Time) error
+	Restore(id string) error
+	// Trashed returns a page of the user's trashed photos, newest first.
+	Trashed(userid string, start pageKey, limit int) ([]photo, pageKey, error)
+	// TrashedBefore returns up to limit photos trashed before t.
+	TrashedBefore(t time.Time, limit int) ([]photo, error)
+	// UpdateCaption sets the caption of the photo named by e and bumps its
+	// Version, provided it still has version e.Version and is not trashed,
+	// and stores e in the edit history in the same transaction. Returns
+	// errConflict otherwise.
+	UpdateCaption(e *captionEdit, caption string) error
+	// SetMedia replaces the media items of the photo and sets Filename to
+	// the first of them, for when its objects move. Returns errNotFound if
+	// there is no such photo.
+	SetMedia(id string, media []mediaItem) error
+	// List returns a page of all photos in no particular order.
+	List(start pageKey, limit int) ([]photo, pageKey, error)
+	// ByUser returns a page of the user's photos, newest first.
+	ByUser(userid string, start pageKey, limit int) ([]photo, pageKey, error)
+	// ByUserBefore returns up to limit photos of the user created before the
+	// given time, newest first.
+	ByUserBefore(userid string, before time.Time, limit int) ([]photo, error)
+	// CountByUser counts the user's photos without using PhotoCount.
+	CountByUser(userid string) (uint, error)
+}
+
+// CommentStore persists photo comments.
+type CommentStore interface {
+	Put(c *comment) error
+	// ByPhoto returns a page of the photo's comments, newest first.
+	ByPhoto(photoid string, start pageKey, limit int) ([]comment, pageKey, error)
+	// DeleteByPhoto removes all comments of the photo.
+	DeleteByPhoto(photoid string) error
+}
+
+// LikeStore persists the likes of photos. Add and Remove update the Likes
+// count of the photo in the same transaction.
+type LikeStore interface {
+	// Add returns errExists if the user already likes the photo.
+	Add(l *like) error
+	// Remove returns errNotFound if the user does not like the photo.
+	Remove(photoid string, userid string) error
+	Exists(photoid string, userid string) (bool, error)
+	// ByPhoto returns a page of the photo's likes, ordered by user ID.
+	ByPhoto(photoid string, start pageKey, limit int) ([]like, pageKey, error)
+	// DeleteByPhoto removes all likes of the photo without touching its
+	// Likes count, for photos that are gone.
+	DeleteByPhoto(photoid string) error
+}
+
+// CaptionEditStore keeps the edit history of photo captions. Records are
+// added by PhotoStore.UpdateCaption.
+type CaptionEditStore interface {
+	// ByPhoto returns the earlier captions of the photo, newest first.
+	ByPhoto(photoid string) ([]captionEdit, error)
+	DeleteByPhoto(photoid string) error
+}
+
+// FollowerStore persists the follow relation between users.
+type FollowerStore interface {
+	// Put adds the follower and increments FollowerCount and FollowingCount
+	// in the same transaction. Returns errExists if it is already there.
+	Put(f *follower) error
+	// Delete removes the follower and decrements the counts in the same
+	// transaction. Returns errNotFound if it is not there.
+	Delete(f *follower) error
+	Exists(userid string, followerid string) (bool, error)
+	// Followers returns the IDs of the users following userid.
+	Followers(userid string) ([]string, error)
+	// Following returns the IDs of the users followerid follows.
+	Following(followerid string) ([]string, error)
+	// FollowersPage and FollowingPage return one page of the IDs returned
+	// by Followers and Following.
+	FollowersPage(userid string, start pageKey, limit int) ([]string, pageKey, error)
+	FollowingPage(followerid string, start pageKey, limit int) ([]string, pageKey, error)
+	// CountFollowers and CountFollowing count the records without using
+	// the counters on the user.
+	CountFollowers(userid string) (uint, error)
+	CountFollowing(userid string) (uint, error)
+}
+
+// FollowRequestStore persists pending follows of private accounts.
+type FollowRequestStore interface {
+	Put(r *followRequest) error
+	// Delete returns errNotFound if there is no such request.
+	Delete(userid string, followerid string) error
+	Exists(userid string, followerid string) (bool, error)
+	// ByUser returns a page of the requests to follow userid, ordered by
+	// follower ID.
+	ByUser(userid string, start pageKey, limit int) ([]followRequest, pageKey, error)
+}
+
+// RelationStore persists a one-way relation between users, like blocks and
+// mutes. userid is the user who created it.
+type RelationStore interface {
+	Put(r *relation) error
+	Delete(userid string, otherid string) error
+	Exists(userid string, otherid string) (bool, error)
+	// Others returns the IDs of all users userid is related to.
+	Others(userid string) ([]string, error)
+	// Page returns a page of Others, ordered by ID.
+	Page(userid string, start pageKey, limit int) ([]string, pageKey, error)
+}
+
+// TimelineStore persists the precomputed home feed of every user.
+type TimelineStore interface {
+	Put(e *timelineEntry) error
+	Delete(userid string, key string) error
+	// DeleteAuthor removes all entries of authorid from the user's timeline.
+	DeleteAuthor(userid string, authorid string) error
+	// Range returns up to limit entries created before the given time,
+	// newest first.
+	Range(userid string, before time.Time, limit int) ([]timelineEntry, error)
+}
+
+// JobStore persists the background jobs that are still to run, see jobs.go.
+type JobStore interface {
+	Put(j *job) error
+	Delete(id string) error
+	// Due returns up to limit jobs whose RunAt is not after t.
+	Due(t time.Time, limit int) ([]job, error)
+}
+
+// Stores bundles the storage backends used by the handlers.
+type Stores struct {
+	Users     UserStore
+	Photos    PhotoStore
+	Comments  CommentStore
+	Edits     CaptionEditStore
+	Likes     LikeStore
+	Followers FollowerStore
+	Requests  FollowRequestStore
+	Blocks    RelationStore
+	Mutes     RelationStore
+	Timeline  TimelineStore
+	Jobs      JobStore
+	Objects   objectstore.ObjectStore
+}
+
+const storesKey = "stores"
+
+// NewStores creates the stores for the backend named by the 'store.backend'
+// configuration key. DynamoDB is used unless "memory" is configured.
+func NewStores() *Stores {
+	backend := viper.GetString("store.backend")
+
+	log.Info("Store backend: ", backend)
+
+	var st *Stores
+
+	if backend == "memory" {
+		st = NewMemoryStores()
+	} else {
+		st = NewDynamoStores()
+	}
+
+	st.Objects = newObjectStore()
+
+	if c := newCache(); c != nil {
+		withCache(st, c)
+	}
+
+	return st
+}
+
+// withStores makes the stores available to the handlers of a request.
+func withStores(st *Stores) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(storesKey, st)
+		c.Next()
+	}
+}
+
+// storesFrom returns the stores registered by withStores.
+func storesFrom(c *gin.Context) *Stores {
+	return c.MustGet(storesKey).(*Stores)
+}
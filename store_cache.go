@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/zoharngo/insta.git/cache"
+)
+
+// storeCache keeps store results in a cache.Cache. The cached stores below
+// read through it and delete the affected keys on every write, so entries
+// only go stale when another instance with its own "lru" cache writes; the
+// TTL bounds that. Users are cached by ID only, with their counters but
+// without password hashes, and usernames map to IDs.
+type storeCache struct {
+	c   cache.Cache
+	ttl time.Duration
+}
+
+type cachedUsers struct {
+	UserStore
+	*storeCache
+}
+
+type cachedPhotos struct {
+	PhotoStore
+	*storeCache
+}
+
+type cachedLikes struct {
+	LikeStore
+	*storeCache
+}
+
+type cachedFollowers struct {
+	FollowerStore
+	*storeCache
+}
+
+// newCache creates the cache named by 'cache.backend': "lru" (the default),
+// "redis" or "none". Returns nil when caching is off.
+func newCache() cache.Cache {
+
+	backend := viper.GetString("cache.backend")
+
+	log.Info("Cache backend: ", backend)
+
+	switch backend {
+	case "none":
+		return nil
+	case "redis":
+		return cache.NewRedis(viper.GetString("cache.redisAddr"),
+			viper.GetString("cache.redisPassword"), viper.GetInt("cache.redisDB"))
+	}
+
+	size := viper.GetInt("cache.size")
+	if size <= 0 {
+		size = 10000
+	}
+
+	c, err := cache.NewLRU(size)
+
+	if err != nil {
+		log.Fatalf("Could not create cache: %v", err)
+	}
+
+	return c
+}
+
+// withCache wraps the user, photo, like and follower stores of st
+func withCache(st *Stores, c cache.Cache) {
+
+	ttl := viper.GetDuration("cache.ttl")
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+
+	sc := &storeCache{c: c, ttl: ttl}
+
+	st.Users = cachedUsers{st.Users, sc}
+	st.Photos = cachedPhotos{st.Photos, sc}
+	st.Likes = cachedLikes{st.Likes, sc}
+	st.Followers = cachedFollowers{st.Followers, sc}
+}
+
+// get decodes the cached value of key into v. Cache errors count as misses.
+func (s *storeCache) get(key string, v interface{}) bool {
+
+	b, err := s.c.Get(key)
+
+	if err != nil {
+		if err != cache.ErrMiss {
+			log.Errorf("Cache get %s failed: %v", key, err)
+		}
+		return false
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		log.Errorf("Cache decode %s failed: %v", key, err)
+		return false
+	}
+
+	return true
+}
+
+func (s *storeCache) set(key string, v interface{}) {
+
+	var b bytes.Buffer
+
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		log.Errorf("Cache encode %s failed: %v", key, err)
+		return
+	}
+
+	if err := s.c.Set(key, b.Bytes(), s.ttl); err != nil {
+		log.Errorf("Cache set %s failed: %v", key, err)
+	}
+}
+
+// invalidate deletes keys after a write
+func (s *storeCache) invalidate(keys ...string) {
+	if err := s.c.Delete(keys...); err != nil {
+		log.Errorf("Cache invalidation of %v failed: %v", keys, err)
+	}
+}
+
+// cacheable returns a copy of u without the password hash, which never
+// leaves the store. Users read through the cache never have it, see
+// uncachedUsers.
+func cacheable(u *user) *user {
+	c := *u
+	c.PasswordHash = ""
+	return &c
+}
+
+// uncachedUsers returns the store behind the cache, for reading password
+// hashes
+func uncachedUsers(users UserStore) UserStore {
+
+	if c, ok := users.(cachedUsers); ok {
+		return c.UserStore
+	}
+
+	return users
+}
+
+func (s cachedUsers) FindByID(id string) (*user, error) {
+
+	u := &user{}
+	if s.get("user:"+id, u) {
+		return u, nil
+	}
+
+	u, err := s.UserStore.FindByID(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u = cacheable(u)
+	s.set("user:"+id, u)
+
+	return u, nil
+}
+
+func (s cachedUsers) FindByUsername(username string) (*user, error) {
+
+	var id string
+	if s.get("username:"+username, &id) {
+		return s.FindByID(id)
+	}
+
+	u, err := s.UserStore.FindByUsername(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u = cacheable(u)
+	s.set("username:"+username, u.ID)
+	s.set("user:"+u.ID, u)
+
+	return u, nil
+}
+
+func (s cachedUsers) FindMany(ids []string) ([]user, error) {
+
+	found := map[string]user{}
+	missing := []string{}
+
+	for _, id := range ids {
+		u := user{}
+		if s.get("user:"+id, &u) {
+			found[id] = u
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		users, err := s.UserStore.FindMany(missing)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range users {
+			u := cacheable(&users[i])
+			found[u.ID] = *u
+			s.set("user:"+u.ID, u)
+		}
+	}
+
+	users := []user{}
+	for _, id := range ids {
+		if u, ok := found[id]; ok {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (s cachedUsers) Put(u *user) error {
+
+	err := s.UserStore.Put(u)
+
+	s.invalidate("user:"+u.ID, "username:"+u.Username)
+
+	return err
+}
+
+func (s cachedUsers) SetCounts(id string, photos uint, followers uint, following uint) error {
+
+	err := s.UserStore.SetCounts(id, photos, followers, following)
+
+	s.invalidate("user:" + id)
+
+	return err
+}
+
+func (s cachedUsers) SetPrivate(id string, private bool) error {
+
+	err := s.UserStore.SetPrivate(id, private)
+
+	s.invalidate("user:" + id)
+
+	return err
+}
+
+func (s cachedUsers) RevokeTokens(id string) error {
+
+	err := s.UserStore.RevokeTokens(id)
+
+	s.invalidate("user:" + id)
+
+	return err
+}
+
+func (s cachedPhotos) Get(id string) (*photo, error) {
+
+	p := &photo{}
+	if s.get("photo:"+id, p) {
+		return p, nil
+	}
+
+	p, err := s.PhotoStore.Get(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.set("photo:"+id, p)
+
+	return p, nil
+}
+
+func (s cachedPhotos) Put(p *photo) error {
+
+	err := s.PhotoStore.Put(p)
+
+	s.invalidate("photo:"+p.ID, "user:"+p.UserID)
+
+	return err
+}
+
+func (s cachedPhotos) Delete(id string) error {
+
+	// The owner is needed to invalidate its PhotoCount
+	p, _ := s.PhotoStore.Get(id)
+
+	err := s.PhotoStore.Delete(id)
+
+	s.invalidate("photo:" + id)
+	if p != nil {
+		s.invalidate("user:" + p.UserID)
+	}
+
+	return err
+}
+
+func (s cachedPhotos) Trash(id string, at time.Time) error {
+	return s.setDeletedAt(id, func() error { return s.PhotoStore.Trash(id, at) })
+}
+
+func (s cachedPhotos) Restore(id string) error {
+	return s.setDeletedAt(id, func() error { return s.PhotoStore.Restore(id) })
+}
+
+// setDeletedAt runs a Trash or Restore and invalidates the photo and the
+// owner's PhotoCount
+func (s cachedPhotos) setDeletedAt(id string, write func() error) error {
+
+	p, _ := s.PhotoStore.Get(id)
+
+	err := write()
+
+	s.invalidate("photo:" + id)
+	if p != nil {
+		s.invalidate("user:" + p.UserID)
+	}
+
+	return err
+}
+
+func (s cachedPhotos) UpdateCaption(e *captionEdit, caption string) error {
+
+	err := s.PhotoStore.UpdateCaption(e, caption)
+
+	s.invalidate("photo:" + e.PhotoID)
+
+	return err
+}
+
+func (s cachedPhotos) SetMedia(id string, media []mediaItem) error {
+
+	err := s.PhotoStore.SetMedia(id, media)
+
+	s.invalidate("photo:" + id)
+
+	return err
+}
+
+func (s cachedLikes) Add(l *like) error {
+
+	err := s.LikeStore.Add(l)
+
+	s.invalidate("photo:" + l.PhotoID)
+
+	return err
+}
+
+func (s cachedLikes) Remove(photoid string, userid string) error {
+
+	err := s.LikeStore.Remove(photoid, userid)
+
+	s.invalidate("photo:" + photoid)
+
+	return err
+}
+
+func (s cachedFollowers) Put(f *follower) error {
+
+	err := s.FollowerStore.Put(f)
+
+	s.invalidate("user:"+f.UserID, "user:"+f.FollowerID)
+
+	return err
+}
+
+func (s cachedFollowers) Delete(f *follower) error {
+
+	err := s.FollowerStore.Delete(f)
+
+	s.invalidate("user:"+f.UserID, "user:"+f.FollowerID)
+
+	return err
+}
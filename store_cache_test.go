@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/zoharngo/insta.git/cache"
+)
+
+func TestCachedUsersPasswordHash(t *testing.T) {
+
+	c, err := cache.NewLRU(100)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := NewMemoryStores()
+	withCache(st, c)
+
+	idp, _ := NewLocalIdentity(st.Users, []byte("secret"))
+
+	if _, err := idp.SignUp("alice", "password", "alice@example.com", "Alice"); err != nil {
+		t.Fatalf("SignUp() error = %v", err)
+	}
+
+	u, err := st.Users.FindByUsername("alice")
+
+	if err != nil {
+		t.Fatalf("FindByUsername() error = %v", err)
+	}
+
+	if u.PasswordHash != "" {
+		t.Error("FindByUsername() returned the password hash")
+	}
+
+	b, err := c.Get("user:" + u.ID)
+
+	if err != nil {
+		t.Fatalf("user not cached, %v", err)
+	}
+
+	cached := user{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&cached); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached.Username != "alice" || cached.PasswordHash != "" {
+		t.Errorf("cached user = %+v, want alice without password hash", cached)
+	}
+
+	// Signing in reads the hash from the store behind the cache
+
+	if _, err := idp.SignIn("alice", "password"); err != nil {
+		t.Errorf("SignIn() error = %v", err)
+	}
+
+	if _, err := idp.SignIn("alice", "wrong"); err != errInvalidCredentials {
+		t.Errorf("SignIn() with a wrong password error = %v, want errInvalidCredentials", err)
+	}
+}
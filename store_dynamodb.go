@@ -0,0 +1,1713 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	usersTable     = "PhotosAppUsers"
+	userKeysTable  = "PhotosAppUserKeys"
+	photosTable    = "PhotosAppPhotos"
+	commentsTable  = "PhotosAppComments"
+	editsTable     = "PhotosAppCaptionEdits"
+	likesTable     = "PhotosAppLikes"
+	followersTable = "PhotosAppFollowers"
+	requestsTable  = "PhotosAppFollowRequests"
+	blocksTable    = "PhotosAppBlocks"
+	mutesTable     = "PhotosAppMutes"
+	timelineTable  = "PhotosAppTimeline"
+	jobsTable      = "PhotosAppJobs"
+)
+
+type dynamoUsers struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoPhotos struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoComments struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoEdits struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoLikes struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoFollowers struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoRequests struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoRelations struct {
+	svc   *dynamodb.DynamoDB
+	table string
+}
+
+type dynamoTimeline struct {
+	svc *dynamodb.DynamoDB
+}
+
+type dynamoJobs struct {
+	svc *dynamodb.DynamoDB
+}
+
+// NewDynamoStores creates stores backed by the PhotosApp DynamoDB tables
+func NewDynamoStores() *Stores {
+
+	sess := session.Must(session.NewSession())
+	svc := dynamodb.New(sess)
+
+	return &Stores{
+		Users:     &dynamoUsers{svc},
+		Photos:    &dynamoPhotos{svc},
+		Comments:  &dynamoComments{svc},
+		Edits:     &dynamoEdits{svc},
+		Likes:     &dynamoLikes{svc},
+		Followers: &dynamoFollowers{svc},
+		Requests:  &dynamoRequests{svc},
+		Blocks:    &dynamoRelations{svc, blocksTable},
+		Mutes:     &dynamoRelations{svc, mutesTable},
+		Timeline:  &dynamoTimeline{svc},
+		Jobs:      &dynamoJobs{svc},
+	}
+}
+
+// eq builds an equality key condition on a string attribute
+func eq(value string) *dynamodb.Condition {
+	return &dynamodb.Condition{
+		ComparisonOperator: aws.String("EQ"),
+		AttributeValueList: []*dynamodb.AttributeValue{
+			{
+				S: aws.String(value),
+			},
+		},
+	}
+}
+
+// startKey converts a page key to an ExclusiveStartKey
+func startKey(key pageKey) map[string]*dynamodb.AttributeValue {
+
+	if len(key) == 0 {
+		return nil
+	}
+
+	av := map[string]*dynamodb.AttributeValue{}
+	for k, v := range key {
+		av[k] = &dynamodb.AttributeValue{S: aws.String(v)}
+	}
+
+	return av
+}
+
+// lastKey converts a LastEvaluatedKey to a page key
+func lastKey(av map[string]*dynamodb.AttributeValue) pageKey {
+
+	if len(av) == 0 {
+		return nil
+	}
+
+	key := pageKey{}
+	for k, v := range av {
+		key[k] = aws.StringValue(v.S)
+	}
+
+	return key
+}
+
+// timestampValue is t as a string attribute that sorts chronologically,
+// see timestamp
+func timestampValue(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{S: aws.String(timestamp(t))}
+}
+
+// marshalItem marshals v with the given time attributes as timestampValue,
+// since they are compared or sorted on
+func marshalItem(v interface{}, times map[string]time.Time) (map[string]*dynamodb.AttributeValue, error) {
+
+	av, err := dynamodbattribute.MarshalMap(v)
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return nil, err
+	}
+
+	for name, t := range times {
+		av[name] = timestampValue(t)
+	}
+
+	return av, nil
+}
+
+// putItem marshals v and writes it to table
+func putItem(svc *dynamodb.DynamoDB, table string, v interface{}) error {
+	return putItemAt(svc, table, v, nil)
+}
+
+// putItemAt is putItem storing the given time attributes as timestampValue
+func putItemAt(svc *dynamodb.DynamoDB, table string, v interface{}, times map[string]time.Time) error {
+
+	av, err := marshalItem(v, times)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      av,
+	})
+
+	if err != nil {
+		log.Errorf("failed to put Record to DynamoDB, %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// count runs a COUNT query over all pages and returns the number of
+// matching items
+func count(svc *dynamodb.DynamoDB, queryInput *dynamodb.QueryInput) (uint, error) {
+
+	queryInput.Select = aws.String("COUNT")
+
+	var n uint
+
+	err := svc.QueryPages(queryInput, func(page *dynamodb.QueryOutput, last bool) bool {
+		n += uint(aws.Int64Value(page.Count))
+		return true
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// batchGet reads the items with the given keys from table, at most 100 per
+// request, retrying unprocessed keys
+func batchGet(svc *dynamodb.DynamoDB, table string, keys []map[string]*dynamodb.AttributeValue) ([]map[string]*dynamodb.AttributeValue, error) {
+
+	items := []map[string]*dynamodb.AttributeValue{}
+
+	for start := 0; start < len(keys); start += 100 {
+		end := start + 100
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		request := map[string]*dynamodb.KeysAndAttributes{
+			table: {Keys: keys[start:end]},
+		}
+
+		for len(request) > 0 {
+			out, err := svc.BatchGetItem(&dynamodb.BatchGetItemInput{
+				RequestItems: request,
+			})
+
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, out.Responses[table]...)
+			request = out.UnprocessedKeys
+		}
+	}
+
+	return items, nil
+}
+
+// uniqueIDs drops repeated IDs, which BatchGetItem rejects
+func uniqueIDs(ids []string) []string {
+
+	seen := map[string]bool{}
+	unique := []string{}
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// userItemKey returns the primary key of a user item. PhotosAppUsers has
+// the username as sort key, so it has to be looked up first.
+func userItemKey(svc *dynamodb.DynamoDB, id string) (map[string]*dynamodb.AttributeValue, error) {
+
+	qo, err := svc.Query(&dynamodb.QueryInput{
+		TableName:              aws.String(usersTable),
+		Limit:                  aws.Int64(1),
+		KeyConditionExpression: aws.String("ID = :id"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":id": {S: aws.String(id)},
+		},
+		ProjectionExpression: aws.String("ID, Username"),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(qo.Items) == 0 {
+		return nil, errNotFound
+	}
+
+	return qo.Items[0], nil
+}
+
+// addCount builds the transaction item that adds n to a counter of a user
+func addCount(key map[string]*dynamodb.AttributeValue, counter string, n int) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:           aws.String(usersTable),
+			Key:                 key,
+			ConditionExpression: aws.String("attribute_exists(ID)"),
+			UpdateExpression:    aws.String("set #c = if_not_exists(#c, :zero) + :num"),
+			ExpressionAttributeNames: map[string]*string{
+				"#c": aws.String(counter),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":zero": {N: aws.String("0")},
+				":num":  {N: aws.String(fmt.Sprint(n))},
+			},
+		},
+	}
+}
+
+func (s *dynamoUsers) findOne(queryInput *dynamodb.QueryInput) (*user, error) {
+
+	qo, err := s.svc.Query(queryInput)
+
+	if err != nil {
+		return nil, err
+	}
+
+	users := []user{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &users); err != nil {
+		log.Errorf("Failed to unmarshal Query result items, %v", err)
+		return nil, err
+	}
+
+	if len(users) == 0 {
+		// Returned no users
+		return nil, errNotFound
+	}
+
+	return &users[0], nil
+}
+
+func (s *dynamoUsers) FindByID(id string) (*user, error) {
+	return s.findOne(&dynamodb.QueryInput{
+		TableName: aws.String(usersTable),
+		Limit:     aws.Int64(1),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"ID": eq(id),
+		},
+	})
+}
+
+func (s *dynamoUsers) FindByUsername(username string) (*user, error) {
+	return s.findOne(&dynamodb.QueryInput{
+		TableName: aws.String(usersTable),
+		Limit:     aws.Int64(1),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"Username": eq(username),
+		},
+		IndexName: aws.String("Username-index"),
+	})
+}
+
+// FindMany reads the users in two batches: their primary keys from
+// PhotosAppUserKeys, keyed on the ID alone, then the users themselves. Users
+// missing from PhotosAppUserKeys, created before it existed, are queried one
+// by one and added to it.
+func (s *dynamoUsers) FindMany(ids []string) ([]user, error) {
+
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, id := range uniqueIDs(ids) {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{
+			"ID": {S: aws.String(id)},
+		})
+	}
+
+	userKeys, err := batchGet(s.svc, userKeysTable, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]user{}
+	known := map[string]bool{}
+
+	for _, key := range userKeys {
+		known[aws.StringValue(key["ID"].S)] = true
+	}
+
+	for _, id := range ids {
+		if known[id] {
+			continue
+		}
+		known[id] = true
+
+		u, err := s.FindByID(id)
+
+		if err == errNotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		found[id] = *u
+
+		if err := putItem(s.svc, userKeysTable, userKeyItem{u.ID, u.Username}); err != nil {
+			log.Errorf("failed to add key of user %s, %v", u.ID, err)
+		}
+	}
+
+	items, err := batchGet(s.svc, usersTable, userKeys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	users := []user{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(items, &users); err != nil {
+		log.Errorf("failed to unmarshal BatchGetItem result items, %v", err)
+		return nil, err
+	}
+
+	for _, u := range users {
+		found[u.ID] = u
+	}
+
+	users = []user{}
+	for _, id := range ids {
+		if u, ok := found[id]; ok {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (s *dynamoUsers) List(start pageKey, limit int) ([]user, pageKey, error) {
+
+	so, err := s.svc.Scan(&dynamodb.ScanInput{
+		TableName:         aws.String(usersTable),
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := []user{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(so.Items, &users); err != nil {
+		log.Errorf("failed to unmarshal Scan result items, %v", err)
+		return nil, nil, err
+	}
+
+	return users, lastKey(so.LastEvaluatedKey), nil
+}
+
+// userKeyItem is an item of PhotosAppUserKeys, the primary key of a user in
+// PhotosAppUsers, which cannot be read in batches by ID alone
+type userKeyItem struct {
+	ID       string
+	Username string
+}
+
+// Put writes the user along with its key in PhotosAppUserKeys
+func (s *dynamoUsers) Put(u *user) error {
+
+	av, err := dynamodbattribute.MarshalMap(u)
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return err
+	}
+
+	key, err := dynamodbattribute.MarshalMap(userKeyItem{u.ID, u.Username})
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return err
+	}
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: &dynamodb.Put{TableName: aws.String(usersTable), Item: av}},
+			{Put: &dynamodb.Put{TableName: aws.String(userKeysTable), Item: key}},
+		},
+	})
+
+	if err != nil {
+		log.Errorf("failed to put Record to DynamoDB, %v", err)
+	}
+
+	return err
+}
+
+func (s *dynamoUsers) SetCounts(id string, photos uint, followers uint, following uint) error {
+
+	key, err := userItemKey(s.svc, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:        aws.String(usersTable),
+		Key:              key,
+		UpdateExpression: aws.String("set PhotoCount = :p, FollowerCount = :f, FollowingCount = :g"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":p": {N: aws.String(fmt.Sprint(photos))},
+			":f": {N: aws.String(fmt.Sprint(followers))},
+			":g": {N: aws.String(fmt.Sprint(following))},
+		},
+	})
+
+	return err
+}
+
+func (s *dynamoUsers) SetPrivate(id string, private bool) error {
+
+	key, err := userItemKey(s.svc, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:        aws.String(usersTable),
+		Key:              key,
+		UpdateExpression: aws.String("set #p = :p"),
+		ExpressionAttributeNames: map[string]*string{
+			"#p": aws.String("Private"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":p": {BOOL: aws.Bool(private)},
+		},
+	})
+
+	return err
+}
+
+func (s *dynamoUsers) RevokeTokens(id string) error {
+
+	key, err := userItemKey(s.svc, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:        aws.String(usersTable),
+		Key:              key,
+		UpdateExpression: aws.String("add TokenVersion :one"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one": {N: aws.String("1")},
+		},
+	})
+
+	return err
+}
+
+func (s *dynamoPhotos) query(queryInput *dynamodb.QueryInput) ([]photo, error) {
+	photos, _, err := s.queryPage(queryInput)
+	return photos, err
+}
+
+// queryPage returns up to Limit photos. DynamoDB applies the query filter
+// after the limit, so it keeps querying until the page is full or the
+// results run out.
+func (s *dynamoPhotos) queryPage(queryInput *dynamodb.QueryInput) ([]photo, pageKey, error) {
+
+	limit := aws.Int64Value(queryInput.Limit)
+	photos := []photo{}
+
+	for {
+		qo, err := s.svc.Query(queryInput)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		items := []photo{}
+		if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &items); err != nil {
+			log.Errorf("failed to unmarshal Query result items, %v", err)
+			return nil, nil, err
+		}
+
+		photos = append(photos, items...)
+
+		if len(qo.LastEvaluatedKey) == 0 || int64(len(photos)) >= limit {
+			return photos, lastKey(qo.LastEvaluatedKey), nil
+		}
+
+		queryInput.ExclusiveStartKey = qo.LastEvaluatedKey
+		queryInput.Limit = aws.Int64(limit - int64(len(photos)))
+	}
+}
+
+func (s *dynamoPhotos) Get(id string) (*photo, error) {
+
+	photos, err := s.query(&dynamodb.QueryInput{
+		TableName: aws.String(photosTable),
+		Limit:     aws.Int64(1),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"ID": eq(id),
+		},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(photos) == 0 {
+		return nil, errNotFound
+	}
+
+	return &photos[0], nil
+}
+
+func (s *dynamoPhotos) GetMany(ids []string) ([]photo, error) {
+
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, id := range uniqueIDs(ids) {
+		keys = append(keys, s.key(id))
+	}
+
+	items, err := batchGet(s.svc, photosTable, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := []photo{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(items, &found); err != nil {
+		log.Errorf("failed to unmarshal BatchGetItem result items, %v", err)
+		return nil, err
+	}
+
+	byID := map[string]photo{}
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+
+	photos := []photo{}
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			photos = append(photos, p)
+		}
+	}
+
+	return photos, nil
+}
+
+func (s *dynamoPhotos) Put(p *photo) error {
+
+	owner, err := userItemKey(s.svc, p.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	av, err := marshalItem(p, map[string]time.Time{"CreatedAt": p.CreatedAt})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(photosTable),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(ID)"),
+				},
+			},
+			addCount(owner, "PhotoCount", 1),
+		},
+	})
+
+	if conditionFailed(err) {
+		return errExists
+	}
+
+	return err
+}
+
+func (s *dynamoPhotos) key(id string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"ID": {S: aws.String(id)},
+	}
+}
+
+func (s *dynamoPhotos) Delete(id string) error {
+
+	p, err := s.Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	// Trashed photos are no longer counted
+	if p.DeletedAt != nil {
+		_, err := s.svc.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String(photosTable),
+			Key:       s.key(id),
+		})
+
+		return err
+	}
+
+	owner, err := userItemKey(s.svc, p.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					TableName:           aws.String(photosTable),
+					Key:                 s.key(id),
+					ConditionExpression: aws.String("attribute_exists(ID) and attribute_not_exists(DeletedAt)"),
+				},
+			},
+			addCount(owner, "PhotoCount", -1),
+		},
+	})
+
+	if conditionFailed(err) {
+		return errNotFound
+	}
+
+	return err
+}
+
+// Trashed photos get the attribute trashPartitionAttr, the hash key of the
+// sparse Trash-DeletedAt-index, so the sweeper only reads the trash
+const (
+	trashPartitionAttr = "Trash"
+	trashPartition     = "trash"
+)
+
+func (s *dynamoPhotos) Trash(id string, at time.Time) error {
+	return s.setDeletedAt(id, &dynamodb.Update{
+		ConditionExpression: aws.String("attribute_exists(ID) and attribute_not_exists(DeletedAt)"),
+		UpdateExpression:    aws.String("set DeletedAt = :t, #p = :p"),
+		ExpressionAttributeNames: map[string]*string{
+			"#p": aws.String(trashPartitionAttr),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": timestampValue(at),
+			":p": {S: aws.String(trashPartition)},
+		},
+	}, -1)
+}
+
+func (s *dynamoPhotos) Restore(id string) error {
+	return s.setDeletedAt(id, &dynamodb.Update{
+		ConditionExpression: aws.String("attribute_exists(DeletedAt)"),
+		UpdateExpression:    aws.String("remove DeletedAt, #p"),
+		ExpressionAttributeNames: map[string]*string{
+			"#p": aws.String(trashPartitionAttr),
+		},
+	}, 1)
+}
+
+// setDeletedAt applies update to the photo and adds n to the owner's
+// PhotoCount in one transaction
+func (s *dynamoPhotos) setDeletedAt(id string, update *dynamodb.Update, n int) error {
+
+	p, err := s.Get(id)
+
+	if err != nil {
+		return err
+	}
+
+	owner, err := userItemKey(s.svc, p.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	update.TableName = aws.String(photosTable)
+	update.Key = s.key(id)
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Update: update},
+			addCount(owner, "PhotoCount", n),
+		},
+	})
+
+	if conditionFailed(err) {
+		return errNotFound
+	}
+
+	return err
+}
+
+func (s *dynamoPhotos) Trashed(userid string, start pageKey, limit int) ([]photo, pageKey, error) {
+	return s.queryPage(&dynamodb.QueryInput{
+		TableName: aws.String(photosTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+		QueryFilter: map[string]*dynamodb.Condition{
+			"DeletedAt": {ComparisonOperator: aws.String("NOT_NULL")},
+		},
+		IndexName:         aws.String("UserID-CreatedAt-index"),
+		ScanIndexForward:  aws.Bool(false),
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+}
+
+func (s *dynamoPhotos) TrashedBefore(t time.Time, limit int) ([]photo, error) {
+	return s.query(&dynamodb.QueryInput{
+		TableName: aws.String(photosTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			trashPartitionAttr: eq(trashPartition),
+			"DeletedAt": {
+				ComparisonOperator: aws.String("LT"),
+				AttributeValueList: []*dynamodb.AttributeValue{timestampValue(t)},
+			},
+		},
+		IndexName: aws.String("Trash-DeletedAt-index"),
+		Limit:     aws.Int64(int64(limit)),
+	})
+}
+
+func (s *dynamoPhotos) UpdateCaption(e *captionEdit, caption string) error {
+
+	av, err := dynamodbattribute.MarshalMap(e)
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return err
+	}
+
+	editedAt, err := dynamodbattribute.Marshal(e.EditedAt)
+
+	if err != nil {
+		return err
+	}
+
+	// Photos from before versioning have no Version attribute
+	condition := "Version = :v"
+	if e.Version == 0 {
+		condition = "(attribute_not_exists(Version) or Version = :v)"
+	}
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName:           aws.String(photosTable),
+					Key:                 s.key(e.PhotoID),
+					ConditionExpression: aws.String("attribute_exists(ID) and attribute_not_exists(DeletedAt) and " + condition),
+					UpdateExpression:    aws.String("set Caption = :c, Version = :next, EditedAt = :t"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":c":    {S: aws.String(caption)},
+						":v":    {N: aws.String(fmt.Sprint(e.Version))},
+						":next": {N: aws.String(fmt.Sprint(e.Version + 1))},
+						":t":    editedAt,
+					},
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(editsTable),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(PhotoID)"),
+				},
+			},
+		},
+	})
+
+	if conditionFailed(err) {
+		return errConflict
+	}
+
+	return err
+}
+
+func (s *dynamoPhotos) SetMedia(id string, media []mediaItem) error {
+
+	av, err := dynamodbattribute.Marshal(media)
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return err
+	}
+
+	_, err = s.svc.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String(photosTable),
+		Key:                 s.key(id),
+		ConditionExpression: aws.String("attribute_exists(ID)"),
+		UpdateExpression:    aws.String("set Filename = :f, Media = :m"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":f": {S: aws.String(media[0].Filename)},
+			":m": av,
+		},
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errNotFound
+	}
+
+	return err
+}
+
+// notTrashed filters trashed photos out of queries and scans
+func notTrashed() map[string]*dynamodb.Condition {
+	return map[string]*dynamodb.Condition{
+		"DeletedAt": {ComparisonOperator: aws.String("NULL")},
+	}
+}
+
+func (s *dynamoPhotos) List(start pageKey, limit int) ([]photo, pageKey, error) {
+
+	so, err := s.svc.Scan(&dynamodb.ScanInput{
+		TableName:         aws.String(photosTable),
+		ScanFilter:        notTrashed(),
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	photos := []photo{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(so.Items, &photos); err != nil {
+		log.Errorf("failed to unmarshal Scan result items, %v", err)
+		return nil, nil, err
+	}
+
+	return photos, lastKey(so.LastEvaluatedKey), nil
+}
+
+func (s *dynamoPhotos) ByUser(userid string, start pageKey, limit int) ([]photo, pageKey, error) {
+	return s.queryPage(&dynamodb.QueryInput{
+		TableName: aws.String(photosTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+		QueryFilter:       notTrashed(),
+		IndexName:         aws.String("UserID-CreatedAt-index"),
+		ScanIndexForward:  aws.Bool(false),
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+}
+
+func (s *dynamoPhotos) ByUserBefore(userid string, before time.Time, limit int) ([]photo, error) {
+	return s.query(&dynamodb.QueryInput{
+		TableName: aws.String(photosTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+			"CreatedAt": {
+				ComparisonOperator: aws.String("LT"),
+				AttributeValueList: []*dynamodb.AttributeValue{timestampValue(before)},
+			},
+		},
+		QueryFilter:      notTrashed(),
+		IndexName:        aws.String("UserID-CreatedAt-index"),
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(int64(limit)),
+	})
+}
+
+func (s *dynamoPhotos) CountByUser(userid string) (uint, error) {
+	return count(s.svc, &dynamodb.QueryInput{
+		TableName: aws.String(photosTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+		QueryFilter: notTrashed(),
+		IndexName:   aws.String("UserID-index"),
+	})
+}
+
+func (s *dynamoComments) Put(c *comment) error {
+	return putItemAt(s.svc, commentsTable, c, map[string]time.Time{"CreatedAt": c.CreatedAt})
+}
+
+func (s *dynamoComments) ByPhoto(photoid string, start pageKey, limit int) ([]comment, pageKey, error) {
+
+	qo, err := s.svc.Query(&dynamodb.QueryInput{
+		TableName: aws.String(commentsTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"PhotoID": eq(photoid),
+		},
+		ScanIndexForward:  aws.Bool(false), // Primary sort key CreatedAt
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	comments := []comment{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &comments); err != nil {
+		log.Errorf("Failed to unmarshal Query result items, %v", err)
+		return nil, nil, err
+	}
+
+	return comments, lastKey(qo.LastEvaluatedKey), nil
+}
+
+func (s *dynamoComments) DeleteByPhoto(photoid string) error {
+	return deletePartition(s.svc, commentsTable, "PhotoID", photoid, "CreatedAt")
+}
+
+func (s *dynamoEdits) ByPhoto(photoid string) ([]captionEdit, error) {
+
+	edits := []captionEdit{}
+	var failed error
+
+	err := s.svc.QueryPages(&dynamodb.QueryInput{
+		TableName: aws.String(editsTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"PhotoID": eq(photoid),
+		},
+		ScanIndexForward: aws.Bool(false), // Primary sort key Version
+	}, func(page *dynamodb.QueryOutput, last bool) bool {
+		items := []captionEdit{}
+		if failed = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); failed != nil {
+			return false
+		}
+		edits = append(edits, items...)
+		return true
+	})
+
+	if err == nil {
+		err = failed
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return edits, nil
+}
+
+func (s *dynamoEdits) DeleteByPhoto(photoid string) error {
+	return deletePartition(s.svc, editsTable, "PhotoID", photoid, "Version")
+}
+
+func (s *dynamoLikes) key(photoid string, userid string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"PhotoID": {S: aws.String(photoid)},
+		"UserID":  {S: aws.String(userid)},
+	}
+}
+
+// updateLikes builds the transaction item that adds n to the photo's Likes
+func (s *dynamoLikes) updateLikes(photoid string, n int) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName: aws.String(photosTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				"ID": {S: aws.String(photoid)},
+			},
+			ConditionExpression: aws.String("attribute_exists(ID)"),
+			UpdateExpression:    aws.String("set Likes = if_not_exists(Likes, :zero) + :num"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":zero": {N: aws.String("0")},
+				":num":  {N: aws.String(fmt.Sprint(n))},
+			},
+		},
+	}
+}
+
+func (s *dynamoLikes) Add(l *like) error {
+
+	av, err := dynamodbattribute.MarshalMap(l)
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return err
+	}
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(likesTable),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(UserID)"),
+				},
+			},
+			s.updateLikes(l.PhotoID, 1),
+		},
+	})
+
+	if conditionFailed(err) {
+		return errExists
+	}
+
+	return err
+}
+
+func (s *dynamoLikes) Remove(photoid string, userid string) error {
+
+	_, err := s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					TableName:           aws.String(likesTable),
+					Key:                 s.key(photoid, userid),
+					ConditionExpression: aws.String("attribute_exists(UserID)"),
+				},
+			},
+			s.updateLikes(photoid, -1),
+		},
+	})
+
+	if conditionFailed(err) {
+		return errNotFound
+	}
+
+	return err
+}
+
+func (s *dynamoLikes) Exists(photoid string, userid string) (bool, error) {
+
+	out, err := s.svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(likesTable),
+		Key:       s.key(photoid, userid),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(out.Item) > 0, nil
+}
+
+func (s *dynamoLikes) ByPhoto(photoid string, start pageKey, limit int) ([]like, pageKey, error) {
+
+	qo, err := s.svc.Query(&dynamodb.QueryInput{
+		TableName: aws.String(likesTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"PhotoID": eq(photoid),
+		},
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	likes := []like{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &likes); err != nil {
+		log.Errorf("Failed to unmarshal Query result items, %v", err)
+		return nil, nil, err
+	}
+
+	return likes, lastKey(qo.LastEvaluatedKey), nil
+}
+
+func (s *dynamoLikes) DeleteByPhoto(photoid string) error {
+	return deletePartition(s.svc, likesTable, "PhotoID", photoid, "UserID")
+}
+
+// conditionFailed reports whether a transaction was canceled because one of
+// its conditions did not hold
+func conditionFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException &&
+		strings.Contains(aerr.Message(), "ConditionalCheckFailed")
+}
+
+func (s *dynamoFollowers) Put(f *follower) error {
+	return s.write(f, 1)
+}
+
+func (s *dynamoFollowers) Delete(f *follower) error {
+	return s.write(f, -1)
+}
+
+// write puts (n = 1) or deletes (n = -1) the follower record and updates
+// the counters of both users in one transaction
+func (s *dynamoFollowers) write(f *follower, n int) error {
+
+	av, err := dynamodbattribute.MarshalMap(f)
+
+	if err != nil {
+		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return err
+	}
+
+	user, err := userItemKey(s.svc, f.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	follower, err := userItemKey(s.svc, f.FollowerID)
+
+	if err != nil {
+		return err
+	}
+
+	record := &dynamodb.TransactWriteItem{}
+	missing := errExists
+
+	if n > 0 {
+		record.Put = &dynamodb.Put{
+			TableName:           aws.String(followersTable),
+			Item:                av,
+			ConditionExpression: aws.String("attribute_not_exists(FollowerID)"),
+		}
+	} else {
+		record.Delete = &dynamodb.Delete{
+			TableName:           aws.String(followersTable),
+			Key:                 av,
+			ConditionExpression: aws.String("attribute_exists(FollowerID)"),
+		}
+		missing = errNotFound
+	}
+
+	_, err = s.svc.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			record,
+			addCount(user, "FollowerCount", n),
+			addCount(follower, "FollowingCount", n),
+		},
+	})
+
+	if conditionFailed(err) {
+		return missing
+	}
+
+	return err
+}
+
+func (s *dynamoFollowers) Exists(userid string, followerid string) (bool, error) {
+
+	n, err := count(s.svc, &dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID":     eq(userid),
+			"FollowerID": eq(followerid),
+		},
+	})
+
+	return n > 0, err
+}
+
+func (s *dynamoFollowers) Followers(userid string) ([]string, error) {
+	return s.ids(&dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+	}, func(f *follower) string { return f.FollowerID })
+}
+
+func (s *dynamoFollowers) Following(followerid string) ([]string, error) {
+	return s.ids(&dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"FollowerID": eq(followerid),
+		},
+		IndexName: aws.String("FollowerID-index"),
+	}, func(f *follower) string { return f.UserID })
+}
+
+func (s *dynamoFollowers) FollowersPage(userid string, start pageKey, limit int) ([]string, pageKey, error) {
+	return s.idsPage(&dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	}, func(f *follower) string { return f.FollowerID })
+}
+
+func (s *dynamoFollowers) FollowingPage(followerid string, start pageKey, limit int) ([]string, pageKey, error) {
+	return s.idsPage(&dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"FollowerID": eq(followerid),
+		},
+		IndexName:         aws.String("FollowerID-index"),
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	}, func(f *follower) string { return f.UserID })
+}
+
+// idsPage runs the query for one page and collects one ID per follower record
+func (s *dynamoFollowers) idsPage(queryInput *dynamodb.QueryInput, id func(f *follower) string) ([]string, pageKey, error) {
+
+	qo, err := s.svc.Query(queryInput)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	followers := []follower{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &followers); err != nil {
+		log.Errorf("Failed to unmarshal Query result items, %v", err)
+		return nil, nil, err
+	}
+
+	ids := make([]string, 0, len(followers))
+	for i := range followers {
+		ids = append(ids, id(&followers[i]))
+	}
+
+	return ids, lastKey(qo.LastEvaluatedKey), nil
+}
+
+// ids runs the query over all pages and collects one ID per follower record
+func (s *dynamoFollowers) ids(queryInput *dynamodb.QueryInput, id func(f *follower) string) ([]string, error) {
+
+	ids := []string{}
+	var uerr error
+
+	err := s.svc.QueryPages(queryInput, func(page *dynamodb.QueryOutput, last bool) bool {
+		followers := []follower{}
+		if uerr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &followers); uerr != nil {
+			log.Errorf("Failed to unmarshal Query result items, %v", uerr)
+			return false
+		}
+		for i := range followers {
+			ids = append(ids, id(&followers[i]))
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if uerr != nil {
+		return nil, uerr
+	}
+
+	return ids, nil
+}
+
+func (s *dynamoFollowers) CountFollowers(userid string) (uint, error) {
+	return count(s.svc, &dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+	})
+}
+
+func (s *dynamoFollowers) CountFollowing(userid string) (uint, error) {
+	return count(s.svc, &dynamodb.QueryInput{
+		TableName: aws.String(followersTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"FollowerID": eq(userid),
+		},
+		IndexName: aws.String("FollowerID-index"),
+	})
+}
+
+func (s *dynamoRequests) key(userid string, followerid string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"UserID":     {S: aws.String(userid)},
+		"FollowerID": {S: aws.String(followerid)},
+	}
+}
+
+func (s *dynamoRequests) Put(r *followRequest) error {
+	return putItem(s.svc, requestsTable, r)
+}
+
+func (s *dynamoRequests) Delete(userid string, followerid string) error {
+
+	_, err := s.svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           aws.String(requestsTable),
+		Key:                 s.key(userid, followerid),
+		ConditionExpression: aws.String("attribute_exists(FollowerID)"),
+	})
+
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return errNotFound
+	}
+
+	return err
+}
+
+func (s *dynamoRequests) Exists(userid string, followerid string) (bool, error) {
+
+	out, err := s.svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(requestsTable),
+		Key:       s.key(userid, followerid),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(out.Item) > 0, nil
+}
+
+func (s *dynamoRequests) ByUser(userid string, start pageKey, limit int) ([]followRequest, pageKey, error) {
+
+	qo, err := s.svc.Query(&dynamodb.QueryInput{
+		TableName: aws.String(requestsTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	requests := []followRequest{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &requests); err != nil {
+		log.Errorf("Failed to unmarshal Query result items, %v", err)
+		return nil, nil, err
+	}
+
+	return requests, lastKey(qo.LastEvaluatedKey), nil
+}
+
+func (s *dynamoRelations) key(userid string, otherid string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"UserID":  {S: aws.String(userid)},
+		"OtherID": {S: aws.String(otherid)},
+	}
+}
+
+func (s *dynamoRelations) Put(r *relation) error {
+	return putItem(s.svc, s.table, r)
+}
+
+func (s *dynamoRelations) Delete(userid string, otherid string) error {
+
+	_, err := s.svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key:       s.key(userid, otherid),
+	})
+
+	return err
+}
+
+func (s *dynamoRelations) Exists(userid string, otherid string) (bool, error) {
+
+	out, err := s.svc.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key:       s.key(userid, otherid),
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(out.Item) > 0, nil
+}
+
+func (s *dynamoRelations) Others(userid string) ([]string, error) {
+
+	ids := []string{}
+
+	err := s.svc.QueryPages(&dynamodb.QueryInput{
+		TableName: aws.String(s.table),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+	}, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range page.Items {
+			ids = append(ids, aws.StringValue(item["OtherID"].S))
+		}
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+func (s *dynamoRelations) Page(userid string, start pageKey, limit int) ([]string, pageKey, error) {
+
+	qo, err := s.svc.Query(&dynamodb.QueryInput{
+		TableName: aws.String(s.table),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+		},
+		Limit:             aws.Int64(int64(limit)),
+		ExclusiveStartKey: startKey(start),
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := []string{}
+	for _, item := range qo.Items {
+		ids = append(ids, aws.StringValue(item["OtherID"].S))
+	}
+
+	return ids, lastKey(qo.LastEvaluatedKey), nil
+}
+
+func (s *dynamoTimeline) Put(e *timelineEntry) error {
+	return putItem(s.svc, timelineTable, e)
+}
+
+func (s *dynamoTimeline) Delete(userid string, key string) error {
+
+	_, err := s.svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(timelineTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {S: aws.String(userid)},
+			"Key":    {S: aws.String(key)},
+		},
+	})
+
+	return err
+}
+
+func (s *dynamoTimeline) DeleteAuthor(userid string, authorid string) error {
+
+	keys := []string{}
+
+	err := s.svc.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String(timelineTable),
+		KeyConditionExpression: aws.String("UserID = :u"),
+		FilterExpression:       aws.String("AuthorID = :a"),
+		ProjectionExpression:   aws.String("#k"),
+		ExpressionAttributeNames: map[string]*string{
+			"#k": aws.String("Key"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":u": {S: aws.String(userid)},
+			":a": {S: aws.String(authorid)},
+		},
+	}, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range page.Items {
+			keys = append(keys, aws.StringValue(item["Key"].S))
+		}
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// BatchWriteItem accepts at most 25 requests
+	for start := 0; start < len(keys); start += 25 {
+		end := start + 25
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		requests := []*dynamodb.WriteRequest{}
+		for _, key := range keys[start:end] {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{
+					Key: map[string]*dynamodb.AttributeValue{
+						"UserID": {S: aws.String(userid)},
+						"Key":    {S: aws.String(key)},
+					},
+				},
+			})
+		}
+
+		if err := batchWrite(s.svc, timelineTable, requests); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *dynamoTimeline) Range(userid string, before time.Time, limit int) ([]timelineEntry, error) {
+
+	qo, err := s.svc.Query(&dynamodb.QueryInput{
+		TableName: aws.String(timelineTable),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"UserID": eq(userid),
+			"Key": {
+				ComparisonOperator: aws.String("LT"),
+				AttributeValueList: []*dynamodb.AttributeValue{
+					timestampValue(before),
+				},
+			},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(int64(limit)),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []timelineEntry{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &entries); err != nil {
+		log.Errorf("Failed to unmarshal Query result items, %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *dynamoJobs) Put(j *job) error {
+	return putItemAt(s.svc, jobsTable, j, map[string]time.Time{"RunAt": j.RunAt})
+}
+
+func (s *dynamoJobs) Delete(id string) error {
+
+	_, err := s.svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(jobsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {S: aws.String(id)},
+		},
+	})
+
+	return err
+}
+
+// Due scans the whole table; it only holds the jobs that have not
+// succeeded yet, so it stays small. RunAt is stored as a timestamp, which
+// makes the string comparison chronological.
+func (s *dynamoJobs) Due(t time.Time, limit int) ([]job, error) {
+
+	jobs := []job{}
+	var failed error
+
+	err := s.svc.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String(jobsTable),
+		FilterExpression: aws.String("RunAt <= :t"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":t": timestampValue(t),
+		},
+	}, func(page *dynamodb.ScanOutput, last bool) bool {
+		items := []job{}
+		if failed = dynamodbattribute.UnmarshalListOfMaps(page.Items, &items); failed != nil {
+			return false
+		}
+		jobs = append(jobs, items...)
+		return len(jobs) < limit
+	})
+
+	if err == nil {
+		err = failed
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+
+	return jobs, nil
+}
+
+// deletePartition deletes every item whose hash key hashAttr is value from
+// a table with the range key rangeAttr
+func deletePartition(svc *dynamodb.DynamoDB, table string, hashAttr string, value string, rangeAttr string) error {
+
+	queryInput := &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("#h = :v"),
+		ProjectionExpression:   aws.String("#h, #r"),
+		ExpressionAttributeNames: map[string]*string{
+			"#h": aws.String(hashAttr),
+			"#r": aws.String(rangeAttr),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":v": {S: aws.String(value)},
+		},
+	}
+
+	requests := []*dynamodb.WriteRequest{}
+
+	err := svc.QueryPages(queryInput, func(page *dynamodb.QueryOutput, last bool) bool {
+		for _, item := range page.Items {
+			requests = append(requests, &dynamodb.WriteRequest{
+				DeleteRequest: &dynamodb.DeleteRequest{Key: item},
+			})
+		}
+		return true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// BatchWriteItem accepts at most 25 requests
+	for start := 0; start < len(requests); start += 25 {
+		end := start + 25
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		if err := batchWrite(svc, table, requests[start:end]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchWrite sends write requests for one table, retrying unprocessed items
+func batchWrite(svc *dynamodb.DynamoDB, table string, requests []*dynamodb.WriteRequest) error {
+
+	items := map[string][]*dynamodb.WriteRequest{table: requests}
+
+	for len(items) > 0 {
+		out, err := svc.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+			RequestItems: items,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		items = out.UnprocessedItems
+	}
+
+	return nil
+}
@@ -0,0 +1,899 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps all records in process memory. It is meant for local
+// development and tests; nothing survives a restart.
+type memoryStore struct {
+	mu        sync.RWMutex
+	users     map[string]user
+	photos    map[string]photo
+	comments  map[string][]comment
+	edits     map[string][]captionEdit   // photoid -> edits, oldest first
+	likes     map[string]map[string]like // photoid -> userid -> like
+	followers map[follower]bool
+	requests  map[follower]followRequest
+	relations map[string]map[relation]bool        // store name -> relations
+	timeline  map[string]map[string]timelineEntry // userid -> key -> entry
+	jobs      map[string]job
+}
+
+type memoryUsers struct{ *memoryStore }
+
+type memoryPhotos struct{ *memoryStore }
+
+type memoryComments struct{ *memoryStore }
+
+type memoryEdits struct{ *memoryStore }
+
+type memoryLikes struct{ *memoryStore }
+
+type memoryFollowers struct{ *memoryStore }
+
+type memoryRequests struct{ *memoryStore }
+
+type memoryRelations struct {
+	*memoryStore
+	name string
+}
+
+type memoryTimeline struct{ *memoryStore }
+
+type memoryJobs struct{ *memoryStore }
+
+// NewMemoryStores creates stores that share a single in-memory backend
+func NewMemoryStores() *Stores {
+
+	m := &memoryStore{
+		users:     map[string]user{},
+		photos:    map[string]photo{},
+		comments:  map[string][]comment{},
+		edits:     map[string][]captionEdit{},
+		likes:     map[string]map[string]like{},
+		followers: map[follower]bool{},
+		requests:  map[follower]followRequest{},
+		relations: map[string]map[relation]bool{"blocks": {}, "mutes": {}},
+		timeline:  map[string]map[string]timelineEntry{},
+		jobs:      map[string]job{},
+	}
+
+	return &Stores{
+		Users:     memoryUsers{m},
+		Photos:    memoryPhotos{m},
+		Comments:  memoryComments{m},
+		Edits:     memoryEdits{m},
+		Likes:     memoryLikes{m},
+		Followers: memoryFollowers{m},
+		Requests:  memoryRequests{m},
+		Blocks:    memoryRelations{m, "blocks"},
+		Mutes:     memoryRelations{m, "mutes"},
+		Timeline:  memoryTimeline{m},
+		Jobs:      memoryJobs{m},
+	}
+}
+
+func (s memoryUsers) FindByID(id string) (*user, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return &u, nil
+}
+
+func (s memoryUsers) FindByUsername(username string) (*user, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+
+	return nil, errNotFound
+}
+
+func (s memoryUsers) FindMany(ids []string) ([]user, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []user{}
+	for _, id := range ids {
+		if u, ok := s.users[id]; ok {
+			users = append(users, u)
+		}
+	}
+
+	return users, nil
+}
+
+func (s memoryUsers) List(start pageKey, limit int) ([]user, pageKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []user{}
+	for _, u := range s.users {
+		if start == nil || u.ID > start["ID"] {
+			users = append(users, u)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+
+	if len(users) > limit {
+		return users[:limit], pageKey{"ID": users[limit-1].ID}, nil
+	}
+
+	return users, nil, nil
+}
+
+func (s memoryUsers) Put(u *user) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[u.ID] = *u
+
+	return nil
+}
+
+func (s memoryUsers) SetCounts(id string, photos uint, followers uint, following uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return errNotFound
+	}
+
+	u.PhotoCount = photos
+	u.FollowerCount = followers
+	u.FollowingCount = following
+	s.users[id] = u
+
+	return nil
+}
+
+func (s memoryUsers) SetPrivate(id string, private bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return errNotFound
+	}
+
+	u.Private = private
+	s.users[id] = u
+
+	return nil
+}
+
+func (s memoryUsers) RevokeTokens(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return errNotFound
+	}
+
+	u.TokenVersion++
+	s.users[id] = u
+
+	return nil
+}
+
+// addCount adds n to one of the counters of a user. The caller holds mu.
+func (m *memoryStore) addCount(id string, n int, counter func(u *user) *uint) {
+
+	u, ok := m.users[id]
+	if !ok {
+		return
+	}
+
+	c := counter(&u)
+	if n > 0 || *c > 0 {
+		*c = uint(int(*c) + n)
+	}
+	m.users[id] = u
+}
+
+func photoCount(u *user) *uint { return &u.PhotoCount }
+
+func followerCount(u *user) *uint { return &u.FollowerCount }
+
+func followingCount(u *user) *uint { return &u.FollowingCount }
+
+func (s memoryPhotos) Get(id string) (*photo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.photos[id]
+	if !ok {
+		return nil, errNotFound
+	}
+
+	return &p, nil
+}
+
+func (s memoryPhotos) GetMany(ids []string) ([]photo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	photos := []photo{}
+	for _, id := range ids {
+		if p, ok := s.photos[id]; ok {
+			photos = append(photos, p)
+		}
+	}
+
+	return photos, nil
+}
+
+func (s memoryPhotos) Put(p *photo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.photos[p.ID]; ok {
+		return errExists
+	}
+
+	s.photos[p.ID] = *p
+	s.addCount(p.UserID, 1, photoCount)
+
+	return nil
+}
+
+func (s memoryPhotos) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.photos[id]
+	if !ok {
+		return errNotFound
+	}
+
+	delete(s.photos, id)
+	if p.DeletedAt == nil {
+		s.addCount(p.UserID, -1, photoCount)
+	}
+
+	return nil
+}
+
+func (s memoryPhotos) Trash(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.photos[id]
+	if !ok || p.DeletedAt != nil {
+		return errNotFound
+	}
+
+	p.DeletedAt = &at
+	s.photos[id] = p
+	s.addCount(p.UserID, -1, photoCount)
+
+	return nil
+}
+
+func (s memoryPhotos) Restore(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.photos[id]
+	if !ok || p.DeletedAt == nil {
+		return errNotFound
+	}
+
+	p.DeletedAt = nil
+	s.photos[id] = p
+	s.addCount(p.UserID, 1, photoCount)
+
+	return nil
+}
+
+func (s memoryPhotos) Trashed(userid string, start pageKey, limit int) ([]photo, pageKey, error) {
+	photos, next := photoPage(s.filter(func(p *photo) bool {
+		return p.UserID == userid && p.DeletedAt != nil
+	}), start, limit)
+	return photos, next, nil
+}
+
+func (s memoryPhotos) TrashedBefore(t time.Time, limit int) ([]photo, error) {
+	photos := s.filter(func(p *photo) bool {
+		return p.DeletedAt != nil && p.DeletedAt.Before(t)
+	})
+
+	if len(photos) > limit {
+		photos = photos[:limit]
+	}
+
+	return photos, nil
+}
+
+func (s memoryPhotos) UpdateCaption(e *captionEdit, caption string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.photos[e.PhotoID]
+	if !ok || p.DeletedAt != nil || p.Version != e.Version {
+		return errConflict
+	}
+
+	editedAt := e.EditedAt
+	p.Caption = caption
+	p.Version++
+	p.EditedAt = &editedAt
+	s.photos[p.ID] = p
+
+	s.edits[p.ID] = append(s.edits[p.ID], *e)
+
+	return nil
+}
+
+func (s memoryPhotos) SetMedia(id string, media []mediaItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.photos[id]
+	if !ok {
+		return errNotFound
+	}
+
+	p.Filename = media[0].Filename
+	p.Media = append([]mediaItem(nil), media...)
+	s.photos[id] = p
+
+	return nil
+}
+
+func (s memoryPhotos) List(start pageKey, limit int) ([]photo, pageKey, error) {
+	photos, next := photoPage(s.filter(func(p *photo) bool { return p.DeletedAt == nil }), start, limit)
+	return photos, next, nil
+}
+
+func (s memoryPhotos) ByUser(userid string, start pageKey, limit int) ([]photo, pageKey, error) {
+	photos, next := photoPage(s.filter(func(p *photo) bool {
+		return p.UserID == userid && p.DeletedAt == nil
+	}), start, limit)
+	return photos, next, nil
+}
+
+func (s memoryPhotos) ByUserBefore(userid string, before time.Time, limit int) ([]photo, error) {
+	photos := s.filter(func(p *photo) bool {
+		return p.UserID == userid && p.DeletedAt == nil && p.CreatedAt.Before(before)
+	})
+
+	if len(photos) > limit {
+		photos = photos[:limit]
+	}
+
+	return photos, nil
+}
+
+func (s memoryPhotos) CountByUser(userid string) (uint, error) {
+	photos := s.filter(func(p *photo) bool { return p.UserID == userid && p.DeletedAt == nil })
+	return uint(len(photos)), nil
+}
+
+// photoPage returns the photos following the one named by start
+func photoPage(photos []photo, start pageKey, limit int) ([]photo, pageKey) {
+
+	from := 0
+	if start != nil {
+		for i := range photos {
+			if photos[i].ID == start["ID"] {
+				from = i + 1
+				break
+			}
+		}
+	}
+
+	photos = photos[from:]
+
+	if len(photos) > limit {
+		return photos[:limit], pageKey{"ID": photos[limit-1].ID}
+	}
+
+	return photos, nil
+}
+
+// filter returns the matching photos, newest first
+func (s memoryPhotos) filter(match func(p *photo) bool) []photo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	photos := []photo{}
+	for _, p := range s.photos {
+		if match(&p) {
+			photos = append(photos, p)
+		}
+	}
+
+	sort.Slice(photos, func(i, j int) bool {
+		return photos[i].CreatedAt.After(photos[j].CreatedAt)
+	})
+
+	return photos
+}
+
+func (s memoryComments) Put(c *comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.comments[c.PhotoID] = append(s.comments[c.PhotoID], *c)
+
+	return nil
+}
+
+func (s memoryComments) ByPhoto(photoid string, start pageKey, limit int) ([]comment, pageKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Newest first, like the CreatedAt sort key descending in DynamoDB
+	all := s.comments[photoid]
+	comments := make([]comment, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		comments = append(comments, all[i])
+	}
+
+	from := 0
+	if start != nil {
+		for i := range comments {
+			if timestamp(comments[i].CreatedAt) == start["CreatedAt"] {
+				from = i + 1
+				break
+			}
+		}
+	}
+
+	comments = comments[from:]
+
+	if len(comments) > limit {
+		last := comments[limit-1]
+		return comments[:limit], pageKey{"PhotoID": photoid, "CreatedAt": timestamp(last.CreatedAt)}, nil
+	}
+
+	return comments, nil, nil
+}
+
+func (s memoryComments) DeleteByPhoto(photoid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.comments, photoid)
+
+	return nil
+}
+
+func (s memoryEdits) ByPhoto(photoid string) ([]captionEdit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := s.edits[photoid]
+	edits := make([]captionEdit, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		edits = append(edits, all[i])
+	}
+
+	return edits, nil
+}
+
+func (s memoryEdits) DeleteByPhoto(photoid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.edits, photoid)
+
+	return nil
+}
+
+func (s memoryLikes) Add(l *like) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.photos[l.PhotoID]
+	if !ok {
+		return errNotFound
+	}
+
+	if _, ok := s.likes[l.PhotoID][l.UserID]; ok {
+		return errExists
+	}
+
+	if s.likes[l.PhotoID] == nil {
+		s.likes[l.PhotoID] = map[string]like{}
+	}
+	s.likes[l.PhotoID][l.UserID] = *l
+
+	p.Likes++
+	s.photos[p.ID] = p
+
+	return nil
+}
+
+func (s memoryLikes) Remove(photoid string, userid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.likes[photoid][userid]; !ok {
+		return errNotFound
+	}
+
+	delete(s.likes[photoid], userid)
+
+	if p, ok := s.photos[photoid]; ok && p.Likes > 0 {
+		p.Likes--
+		s.photos[photoid] = p
+	}
+
+	return nil
+}
+
+func (s memoryLikes) Exists(photoid string, userid string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.likes[photoid][userid]
+
+	return ok, nil
+}
+
+func (s memoryLikes) ByPhoto(photoid string, start pageKey, limit int) ([]like, pageKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Ordered by user ID, like the UserID sort key in DynamoDB
+	likes := []like{}
+	for _, l := range s.likes[photoid] {
+		if start == nil || l.UserID > start["UserID"] {
+			likes = append(likes, l)
+		}
+	}
+
+	sort.Slice(likes, func(i, j int) bool {
+		return likes[i].UserID < likes[j].UserID
+	})
+
+	if len(likes) > limit {
+		return likes[:limit], pageKey{"PhotoID": photoid, "UserID": likes[limit-1].UserID}, nil
+	}
+
+	return likes, nil, nil
+}
+
+func (s memoryLikes) DeleteByPhoto(photoid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.likes, photoid)
+
+	return nil
+}
+
+func (s memoryFollowers) Put(f *follower) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.followers[*f] {
+		return errExists
+	}
+
+	s.followers[*f] = true
+	s.addCount(f.UserID, 1, followerCount)
+	s.addCount(f.FollowerID, 1, followingCount)
+
+	return nil
+}
+
+func (s memoryFollowers) Delete(f *follower) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.followers[*f] {
+		return errNotFound
+	}
+
+	delete(s.followers, *f)
+	s.addCount(f.UserID, -1, followerCount)
+	s.addCount(f.FollowerID, -1, followingCount)
+
+	return nil
+}
+
+func (s memoryFollowers) Exists(userid string, followerid string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.followers[follower{UserID: userid, FollowerID: followerid}], nil
+}
+
+func (s memoryFollowers) Followers(userid string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	for f := range s.followers {
+		if f.UserID == userid {
+			ids = append(ids, f.FollowerID)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s memoryFollowers) Following(followerid string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	for f := range s.followers {
+		if f.FollowerID == followerid {
+			ids = append(ids, f.UserID)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s memoryFollowers) FollowersPage(userid string, start pageKey, limit int) ([]string, pageKey, error) {
+	ids, _ := s.Followers(userid)
+	return idPage(ids, "UserID", userid, "FollowerID", start, limit)
+}
+
+func (s memoryFollowers) FollowingPage(followerid string, start pageKey, limit int) ([]string, pageKey, error) {
+	ids, _ := s.Following(followerid)
+	return idPage(ids, "FollowerID", followerid, "UserID", start, limit)
+}
+
+// idPage pages IDs in sort order, with keys shaped like those of the
+// followers table: the fixed attribute plus the attribute holding the ID
+func idPage(ids []string, fixed string, value string, attr string, start pageKey, limit int) ([]string, pageKey, error) {
+
+	sort.Strings(ids)
+
+	from := 0
+	if start != nil {
+		from = sort.SearchStrings(ids, start[attr])
+		if from < len(ids) && ids[from] == start[attr] {
+			from++
+		}
+	}
+
+	ids = ids[from:]
+
+	if len(ids) > limit {
+		return ids[:limit], pageKey{fixed: value, attr: ids[limit-1]}, nil
+	}
+
+	return ids, nil, nil
+}
+
+func (s memoryFollowers) CountFollowers(userid string) (uint, error) {
+	return s.count(func(f follower) bool { return f.UserID == userid }), nil
+}
+
+func (s memoryFollowers) CountFollowing(userid string) (uint, error) {
+	return s.count(func(f follower) bool { return f.FollowerID == userid }), nil
+}
+
+func (s memoryFollowers) count(match func(f follower) bool) uint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n uint
+	for f := range s.followers {
+		if match(f) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (s memoryRequests) Put(r *followRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[follower{r.UserID, r.FollowerID}] = *r
+
+	return nil
+}
+
+func (s memoryRequests) Delete(userid string, followerid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := follower{userid, followerid}
+
+	if _, ok := s.requests[key]; !ok {
+		return errNotFound
+	}
+
+	delete(s.requests, key)
+
+	return nil
+}
+
+func (s memoryRequests) Exists(userid string, followerid string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.requests[follower{userid, followerid}]
+
+	return ok, nil
+}
+
+func (s memoryRequests) ByUser(userid string, start pageKey, limit int) ([]followRequest, pageKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	requests := []followRequest{}
+	for _, r := range s.requests {
+		if r.UserID == userid && (start == nil || r.FollowerID > start["FollowerID"]) {
+			requests = append(requests, r)
+		}
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].FollowerID < requests[j].FollowerID
+	})
+
+	if len(requests) > limit {
+		last := requests[limit-1]
+		return requests[:limit], pageKey{"UserID": userid, "FollowerID": last.FollowerID}, nil
+	}
+
+	return requests, nil, nil
+}
+
+func (s memoryRelations) Put(r *relation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.relations[s.name][relation{UserID: r.UserID, OtherID: r.OtherID}] = true
+
+	return nil
+}
+
+func (s memoryRelations) Delete(userid string, otherid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.relations[s.name], relation{UserID: userid, OtherID: otherid})
+
+	return nil
+}
+
+func (s memoryRelations) Exists(userid string, otherid string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.relations[s.name][relation{UserID: userid, OtherID: otherid}], nil
+}
+
+func (s memoryRelations) Others(userid string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	for r := range s.relations[s.name] {
+		if r.UserID == userid {
+			ids = append(ids, r.OtherID)
+		}
+	}
+
+	return ids, nil
+}
+
+func (s memoryRelations) Page(userid string, start pageKey, limit int) ([]string, pageKey, error) {
+	ids, _ := s.Others(userid)
+	return idPage(ids, "UserID", userid, "OtherID", start, limit)
+}
+
+func (s memoryTimeline) Put(e *timelineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timeline[e.UserID] == nil {
+		s.timeline[e.UserID] = map[string]timelineEntry{}
+	}
+	s.timeline[e.UserID][e.Key] = *e
+
+	return nil
+}
+
+func (s memoryTimeline) Delete(userid string, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.timeline[userid], key)
+
+	return nil
+}
+
+func (s memoryTimeline) DeleteAuthor(userid string, authorid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, e := range s.timeline[userid] {
+		if e.AuthorID == authorid {
+			delete(s.timeline[userid], key)
+		}
+	}
+
+	return nil
+}
+
+func (s memoryTimeline) Range(userid string, before time.Time, limit int) ([]timelineEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []timelineEntry{}
+	for _, e := range s.timeline[userid] {
+		if e.CreatedAt.Before(before) {
+			entries = append(entries, e)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key > entries[j].Key
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+func (s memoryJobs) Put(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[j.ID] = *j
+
+	return nil
+}
+
+func (s memoryJobs) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, id)
+
+	return nil
+}
+
+func (s memoryJobs) Due(t time.Time, limit int) ([]job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := []job{}
+	for _, j := range s.jobs {
+		if !j.RunAt.After(t) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].RunAt.Before(jobs[j].RunAt)
+	})
+
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+
+	return jobs, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// timelineEntry is a photo pushed onto a user's home timeline
+type timelineEntry struct {
+	UserID    string // owner of the timeline
+	Key       string // sort key, see timelineKey
+	PhotoID   string
+	AuthorID  string
+	CreatedAt time.Time
+}
+
+// backfillSize is how many recent photos are copied onto a timeline when a
+// user follows someone
+const backfillSize = 20
+
+// timelineKey sorts entries by creation time and keeps them unique per photo
+func timelineKey(createdAt time.Time, photoid string) string {
+	return timestamp(createdAt) + "/" + photoid
+}
+
+func newTimelineEntry(userid string, p *photo) *timelineEntry {
+	return &timelineEntry{
+		UserID:    userid,
+		Key:       timelineKey(p.CreatedAt, p.ID),
+		PhotoID:   p.ID,
+		AuthorID:  p.UserID,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// timelineEnabled reports whether feeds are read from the timeline store
+// rather than computed from the followers at read time
+func timelineEnabled(st *Stores) bool {
+	return st.Timeline != nil && viper.GetBool("feed.timeline")
+}
+
+// fanOut runs fn for every user ID in the background, see forEachUser
+func fanOut(userids []string, what string, fn func(userid string) error) {
+	go forEachUser(userids, what, fn)
+}
+
+// forEachUser runs fn for every user ID with at most
+// 'feed.fanoutConcurrency' calls in flight. Failures are logged and the
+// first one is returned.
+func forEachUser(userids []string, what string, fn func(userid string) error) error {
+
+	workers := viper.GetInt("feed.fanoutConcurrency")
+	if workers <= 0 {
+		workers = 8
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var first error
+
+	for _, id := range userids {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(id string) {
+			defer func() { <-sem; wg.Done() }()
+
+			if err := fn(id); err != nil {
+				log.Errorf("Timeline %s failed for %s: %v", what, id, err)
+
+				mu.Lock()
+				if first == nil {
+					first = err
+				}
+				mu.Unlock()
+			}
+		}(id)
+	}
+
+	wg.Wait()
+	log.Debugf("Timeline %s done for %d users", what, len(userids))
+
+	return first
+}
+
+// publishToTimelines puts a new photo on its author's timeline right away and
+// on every follower's timeline in the background
+func publishToTimelines(st *Stores, p *photo) error {
+
+	if !timelineEnabled(st) {
+		return nil
+	}
+
+	if err := st.Timeline.Put(newTimelineEntry(p.UserID, p)); err != nil {
+		return err
+	}
+
+	followers, err := st.Followers.Followers(p.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	fanOut(followers, "publish", func(userid string) error {
+		return st.Timeline.Put(newTimelineEntry(userid, p))
+	})
+
+	return nil
+}
+
+// retractFromTimelines removes a deleted photo from its author's and every
+// follower's timeline. It runs as part of purgePhoto, so it waits for all
+// of them.
+func retractFromTimelines(st *Stores, p *photo) error {
+
+	if !timelineEnabled(st) {
+		return nil
+	}
+
+	followers, err := st.Followers.Followers(p.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	key := timelineKey(p.CreatedAt, p.ID)
+
+	return forEachUser(append(followers, p.UserID), "retract", func(userid string) error {
+		return st.Timeline.Delete(userid, key)
+	})
+}
+
+// backfillTimeline copies the recent photos of userid onto the timeline of a
+// new follower
+func backfillTimeline(st *Stores, userid string, followerid string) {
+
+	if !timelineEnabled(st) {
+		return
+	}
+
+	fanOut([]string{followerid}, "backfill", func(followerid string) error {
+		photos, err := st.Photos.ByUserBefore(userid, time.Now(), backfillSize)
+
+		if err != nil {
+			return err
+		}
+
+		for i := range photos {
+			if err := st.Timeline.Put(newTimelineEntry(followerid, &photos[i])); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// pruneTimeline removes the photos of userid from the timeline of a former
+// follower
+func pruneTimeline(st *Stores, userid string, followerid string) {
+
+	if !timelineEnabled(st) {
+		return
+	}
+
+	fanOut([]string{followerid}, "prune", func(followerid string) error {
+		return st.Timeline.DeleteAuthor(followerid, userid)
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestTimelineKeyOrder(t *testing.T) {
+
+	base := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// Ascending, with fractions that RFC3339Nano would shorten
+	times := []time.Time{
+		base,
+		base.Add(100 * time.Millisecond),
+		base.Add(123 * time.Millisecond),
+		base.Add(500 * time.Millisecond),
+		base.Add(time.Second),
+	}
+
+	keys := []string{}
+	for _, ts := range times {
+		keys = append(keys, timelineKey(ts.In(time.FixedZone("CET", 3600)), "photo"))
+	}
+
+	if !sort.StringsAreSorted(keys) {
+		t.Errorf("timeline keys do not sort chronologically: %q", keys)
+	}
+
+	for i, ts := range times {
+		if bound := timestamp(ts); bound >= keys[i] || (i > 0 && bound <= keys[i-1]) {
+			t.Errorf("bound %q does not separate key %d of %q", bound, i, keys)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Deleted photos go to the trash first: they keep their record with
+// DeletedAt set, disappear from every listing and can be restored for
+// 'trash.retention'. The sweeper then deletes them for good with deletePhoto.
+
+// trashRetention is how long trashed photos can be restored, 30 days unless
+// 'trash.retention' says otherwise
+func trashRetention() time.Duration {
+
+	retention := viper.GetDuration("trash.retention")
+	if retention <= 0 {
+		retention = 30 * 24 * time.Hour
+	}
+
+	return retention
+}
+
+// trashPhoto moves the photo to the trash
+func trashPhoto(st *Stores, id string) error {
+	return st.Photos.Trash(id, time.Now().UTC())
+}
+
+// restorePhoto takes a trashed photo out of the trash. Returns errNotFound
+// once the restore window is over.
+func restorePhoto(st *Stores, p *photo) error {
+
+	if p.DeletedAt == nil || time.Since(*p.DeletedAt) > trashRetention() {
+		return errNotFound
+	}
+
+	return st.Photos.Restore(p.ID)
+}
+
+// RestoreDeadline is when a trashed photo is deleted for good. Meant for
+// templates.
+func (p *photo) RestoreDeadline() time.Time {
+
+	if p.DeletedAt == nil {
+		return time.Time{}
+	}
+
+	return p.DeletedAt.Add(trashRetention())
+}
+
+// sweepTrash deletes the photos trashed longer than the retention and
+// returns how many. It stops at the first failure; the next sweep retries.
+func sweepTrash(st *Stores) (int, error) {
+
+	n := 0
+
+	for {
+		photos, err := st.Photos.TrashedBefore(time.Now().UTC().Add(-trashRetention()), jobsBatch)
+
+		if err != nil || len(photos) == 0 {
+			return n, err
+		}
+
+		for _, p := range photos {
+			if err := deletePhoto(st, p.ID); err != nil && err != errNotFound {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+// startSweeper runs sweepTrash in the background every 'trash.sweepInterval'
+func startSweeper(st *Stores) {
+
+	interval := viper.GetDuration("trash.sweepInterval")
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			n, err := sweepTrash(st)
+
+			if err != nil {
+				log.Errorf("Error sweeping trash: %v", err)
+			}
+
+			if n > 0 {
+				log.Infof("Swept %d trashed photos", n)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+// sweep deletes expired photos from the trash once
+func sweep(st *Stores, args []string) error {
+
+	n, err := sweepTrash(st)
+
+	log.Infof("Swept %d trashed photos", n)
+
+	return err
+}
+
+// RecentlyDeleted lists the photos in the trash of the current user
+// GET /settings/deleted
+func RecentlyDeleted(c *gin.Context) {
+
+	st := storesFrom(c)
+	user := currentUser(c)
+
+	start, err := decodeCursor(c.Query("cursor"))
+
+	if err != nil {
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
+	}
+
+	photos, next, err := st.Photos.Trashed(user.ID, start, pageSize(c))
+
+	if err != nil {
+		log.Errorf("Error loading trashed photos: %v", err)
+	}
+
+	c.HTML(http.StatusOK, "deleted.html", gin.H{
+		"title":       "Recently deleted",
+		"user":        user,
+		"photos":      photos,
+		"days":        int(trashRetention().Hours() / 24),
+		"next":        encodeCursor(next),
+		"CurrentUser": user,
+	})
+}
+
+// RestorePhoto takes a photo out of the trash
+// POST /photos/:id/restore
+func RestorePhoto(c *gin.Context) {
+
+	err := restorePhoto(storesFrom(c), authorizedPhoto(c))
+
+	if err == errNotFound {
+		c.JSON(http.StatusNotFound, nil)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to restore photo, %v", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
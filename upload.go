@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/zoharngo/insta.git/imaging"
+	"github.com/zoharngo/insta.git/video"
+)
+
+// Uploads are checked by content, never by their name: the first bytes decide
+// whether a file is an image or a video, and it is decoded completely before
+// anything is stored. The limits come from the [upload] section.
+
+// uploadError is an upload rejected because of its content, with the 4xx
+// status to answer
+type uploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *uploadError) Error() string {
+	return e.Message
+}
+
+// rejectUpload returns an uploadError with a message about the named file
+func rejectUpload(status int, filename string, format string, args ...interface{}) error {
+	return &uploadError{status, filename + ": " + fmt.Sprintf(format, args...)}
+}
+
+// uploadStatus is the status answering a failed upload: the one of an
+// uploadError, 500 otherwise
+func uploadStatus(err error) int {
+
+	if e, ok := err.(*uploadError); ok {
+		return e.Status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// sizeLimit reads a size such as "20MB" from the config, with a default
+func sizeLimit(key string, def int64) int64 {
+
+	if size := int64(viper.GetSizeInBytes(key)); size > 0 {
+		return size
+	}
+
+	return def
+}
+
+// limitUpload caps the request body at 'upload.maxPostSize' so huge uploads
+// are cut off before they are spooled to disk
+func limitUpload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, sizeLimit("upload.maxPostSize", 256<<20))
+}
+
+// formStatus is the status answering a form that could not be parsed, 413
+// when it was cut off by limitUpload
+func formStatus(err error) int {
+
+	var tooLarge *http.MaxBytesError
+
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
+// checkUpload validates an upload before it is stored and returns its
+// content type. Videos get their type, codec and duration recorded on item.
+func checkUpload(file multipart.File, fh *multipart.FileHeader, item *mediaItem) (string, error) {
+
+	head := make([]byte, 512)
+
+	n, err := file.ReadAt(head, 0)
+
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	if n == 0 {
+		return "", rejectUpload(http.StatusBadRequest, fh.Filename, "the file is empty")
+	}
+
+	contentType := sniffContentType(head[:n])
+
+	if strings.HasPrefix(contentType, "video/") {
+		return checkVideo(file, fh, item)
+	}
+
+	item.Format = imaging.Detect(head[:n])
+
+	if item.Format == "" {
+		return "", rejectUpload(http.StatusUnsupportedMediaType, fh.Filename, "only JPEG, PNG, GIF, WebP and HEIC images and MP4 and WebM videos can be uploaded")
+	}
+
+	return contentType, checkImage(file, fh, item)
+}
+
+// sniffContentType detects the content type from the first bytes of a file.
+// MP4 stands in for all containers of the MP4 family; video.Probe tells them
+// apart.
+func sniffContentType(head []byte) string {
+
+	if video.Sniff(head) {
+		if len(head) >= 8 && string(head[4:8]) == "ftyp" {
+			return "video/mp4"
+		}
+		return "video/webm"
+	}
+
+	if format := imaging.Detect(head); format != "" {
+		return imaging.ContentType(format)
+	}
+
+	return http.DetectContentType(head)
+}
+
+// checkImage enforces 'upload.maxImageSize' and 'upload.maxDimension' and
+// 'upload.maxPixels', the latter two from the header so decompression bombs
+// are never decoded, then decodes the whole image. Formats without a decoder
+// cannot be checked and are rejected.
+func checkImage(file multipart.File, fh *multipart.FileHeader, item *mediaItem) error {
+
+	if max := sizeLimit("upload.maxImageSize", 20<<20); fh.Size > max {
+		return rejectUpload(http.StatusRequestEntityTooLarge, fh.Filename, "images can be at most %d MB", max>>20)
+	}
+
+	if !imaging.Supported(item.Format) {
+		return rejectUpload(http.StatusUnsupportedMediaType, fh.Filename, "%s", unsupportedFormat(item.Format))
+	}
+
+	config, _, err := imaging.DecodeConfig(newReader(file, fh))
+
+	if err != nil {
+		return rejectUpload(http.StatusUnprocessableEntity, fh.Filename, "the image is damaged")
+	}
+
+	maxDimension := viper.GetInt("upload.maxDimension")
+	if maxDimension <= 0 {
+		maxDimension = 8192
+	}
+
+	maxPixels := viper.GetInt64("upload.maxPixels")
+	if maxPixels <= 0 {
+		maxPixels = 40000000
+	}
+
+	if config.Width > maxDimension || config.Height > maxDimension || int64(config.Width)*int64(config.Height) > maxPixels {
+		return rejectUpload(http.StatusUnprocessableEntity, fh.Filename, "images can be at most %d pixels wide and high and %d megapixels", maxDimension, maxPixels/1000000)
+	}
+
+	if _, _, err := imaging.Decode(newReader(file, fh)); err != nil {
+		return rejectUpload(http.StatusUnprocessableEntity, fh.Filename, "the image is damaged")
+	}
+
+	return nil
+}
+
+// checkVideo enforces 'video.maxSize' and the container, codec and length
+// checks of probeVideo
+func checkVideo(file multipart.File, fh *multipart.FileHeader, item *mediaItem) (string, error) {
+
+	if max := sizeLimit("video.maxSize", 100<<20); fh.Size > max {
+		return "", rejectUpload(http.StatusRequestEntityTooLarge, fh.Filename, "videos can be at most %d MB", max>>20)
+	}
+
+	info, err := probeVideo(file, fh)
+
+	if err != nil {
+		return "", err
+	}
+
+	item.Type = videoItem
+	item.Codec = info.Codec
+	item.Duration = info.Duration
+
+	return info.ContentType, nil
+}
+
+// newReader reads the upload from the start, independently of other readers
+func newReader(file multipart.File, fh *multipart.FileHeader) *io.SectionReader {
+	return io.NewSectionReader(file, 0, fh.Size)
+}
@@ -3,15 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
-	"errors"
 	"net/http"
+	"time"
 
-	log "github.com/Sirupsen/logrus"
+	log "github.com/sirupsen/logrus"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -23,6 +20,19 @@ type user struct {
 	Email    string
 	Username string
 	FullName string
+
+	// Counters maintained by the photo and follower stores
+	PhotoCount     uint
+	FollowerCount  uint
+	FollowingCount uint
+
+	// Private accounts only show their photos to approved followers
+	Private bool
+
+	// PasswordHash and TokenVersion are only set for accounts of the local
+	// identity provider, whose tokens are valid for the current version only
+	PasswordHash string `json:"-" dynamodbav:",omitempty"`
+	TokenVersion uint   `json:"-" dynamodbav:",omitempty"`
 }
 
 type follower struct {
@@ -39,12 +49,7 @@ func init() {
 
 	log.Info("Initializing SNS")
 
-	log.Info("Loading configuration")
-	viper.SetConfigName("config") // config.toml
-	viper.AddConfigPath(".")      // use working directory
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Errorf("error reading config file, %v", err)
+	if !configLoaded {
 		return
 	}
 
@@ -70,7 +75,7 @@ func login(c *gin.Context) {
 
 	// Get user by username
 
-	if _, err := findUserByUsername(username); err != nil {
+	if _, err := storesFrom(c).Users.FindByUsername(username); err != nil {
 		sessionStore.AddFlash("User not found")
 		sessionStore.Save()
 		c.HTML(http.StatusOK, "login.html", gin.H{
@@ -78,12 +83,12 @@ func login(c *gin.Context) {
 			"user":  u,
 		})
 	} else {
-		log.Info("Authenticating via Cognito: ", username)
-		cog := NewCognito()
-		jwt, err := cog.SignIn(username, password)
+		log.Info("Authenticating: ", username)
+		idp := identityFrom(c)
+		tokens, err := idp.SignIn(username, password)
 
 		if err != nil {
-			msg := err.(awserr.Error).Message()
+			msg := authErrorMessage(err)
 			log.Error("Signin Error: ", msg)
 			sessionStore.AddFlash(msg)
 			sessionStore.Save()
@@ -93,10 +98,8 @@ func login(c *gin.Context) {
 			})
 		} else {
 			log.Info("Authentication successful")
-			sub, _ := cog.ValidateToken(jwt)
-			sessionStore.Set(accessToken, jwt)
-			sessionStore.Set(userKey, sub)
-			sessionStore.Save()
+			sub, _ := idp.ValidateToken(tokens.AccessToken)
+			saveTokens(sessionStore, sub, tokens)
 			t := sessionStore.Get(accessToken)
 			log.Debug("Testing user in session:", t)
 			c.Redirect(http.StatusFound, "/photos")
@@ -119,8 +122,9 @@ func signup(c *gin.Context) {
 	}
 
 	sessionStore := sessions.Default(c)
+	st := storesFrom(c)
 
-	u, _ := findUserByUsername(user.Username)
+	u, _ := st.Users.FindByUsername(user.Username)
 
 	if u != nil {
 		msg := "This username isn't available. Please try another."
@@ -133,12 +137,12 @@ func signup(c *gin.Context) {
 		return
 	}
 
-	cog := NewCognito()
+	idp := identityFrom(c)
 	password := c.PostForm("password")
-	jwt, err := cog.SignUp(user.Username, password, user.Email, user.FullName)
+	tokens, err := idp.SignUp(user.Username, password, user.Email, user.FullName)
 
 	if err != nil {
-		msg := err.(awserr.Error).Message()
+		msg := authErrorMessage(err)
 		log.Error("SignUp error: ", msg)
 		sessionStore.AddFlash(msg)
 		c.HTML(http.StatusOK, "signup.html", gin.H{
@@ -151,41 +155,23 @@ func signup(c *gin.Context) {
 
 	log.Info("Creating DB user:", user.Username)
 
-	sub, err := cog.ValidateToken(jwt)
+	sub, err := idp.ValidateToken(tokens.AccessToken)
 
 	if err != nil {
 		return
 	}
 
-	log.Info("Cognito 'sub': ", sub)
-
-	user.ID = sub // Set user ID to Cognito UUID
+	log.Info("Identity 'sub': ", sub)
 
-	// Create user in DynamoDB
+	user.ID = sub // Set user ID to the identity provider UUID
 
-	av, err := dynamodbattribute.MarshalMap(user)
-
-	if err != nil {
-		log.Errorf("failed to DynamoDB marshal Record, %v", err)
-		sessionStore.AddFlash(err)
-		c.HTML(http.StatusOK, "signup.html", gin.H{
-			"flash": sessionStore.Flashes(),
-			"user":  user,
-		})
+	// Create user in the user store, unless the identity provider keeps its
+	// accounts there and already did
 
-		c.Redirect(http.StatusFound, "/photos")
-		sessionStore.Save()
-		return
+	if _, err = st.Users.FindByID(sub); err == errNotFound {
+		err = st.Users.Put(user)
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	_, err = svc.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("PhotosAppUsers"),
-		Item:      av,
-	})
-
 	if err != nil {
 		log.Errorf("Error: %v", err)
 		sessionStore.AddFlash(err)
@@ -195,9 +181,7 @@ func signup(c *gin.Context) {
 		})
 	} else {
 		log.Info("Saving userid in session for: ", user.Username)
-		sessionStore.Set(userKey, user.ID)
-		sessionStore.Set(accessToken, jwt)
-		sessionStore.Save()
+		saveTokens(sessionStore, user.ID, tokens)
 		c.Redirect(http.StatusFound, "/photos")
 	}
 
@@ -205,6 +189,7 @@ func signup(c *gin.Context) {
 
 	log.Info("Sending SNS message")
 
+	sess := session.Must(session.NewSession())
 	snssvc := sns.New(sess)
 
 	var buffer bytes.Buffer
@@ -228,6 +213,13 @@ func signup(c *gin.Context) {
 
 func logout(c *gin.Context) {
 	session := sessions.Default(c)
+
+	if jwt, ok := session.Get(accessToken).(string); ok {
+		if err := identityFrom(c).SignOut(jwt); err != nil {
+			log.Warn("SignOut error: ", err)
+		}
+	}
+
 	session.Clear()
 	session.Options(sessions.Options{MaxAge: -1})
 	session.Save()
@@ -239,7 +231,9 @@ func logout(c *gin.Context) {
 func Profile(c *gin.Context) {
 	username := c.Params.ByName("username")
 
-	user, err := findUserByUsername(username)
+	st := storesFrom(c)
+
+	user, err := st.Users.FindByUsername(username)
 
 	if err != nil {
 		log.Error("Error:", err)
@@ -249,342 +243,231 @@ func Profile(c *gin.Context) {
 
 	// Find photos by user
 
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppPhotos"),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"UserID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(user.ID),
-					},
-				},
-			},
-		},
-		IndexName: aws.String("UserID-index"),
-	}
-
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	qo, err := svc.Query(queryInput)
+	start, err := decodeCursor(c.Query("cursor"))
 
 	if err != nil {
-		log.Errorf("Error: %v", err)
-		c.HTML(http.StatusOK, "404.html", nil)
+		c.HTML(http.StatusBadRequest, "404.html", nil)
 		return
 	}
 
-	photos := []photo{}
-	err = dynamodbattribute.UnmarshalListOfMaps(qo.Items, &photos)
+	visible, err := canSeePhotos(st, currentUserID(c), user)
+
 	if err != nil {
-		log.Errorf("failed to unmarshal Query result items, %v", err)
+		log.Errorf("Error: %v", err)
 		c.HTML(http.StatusOK, "404.html", nil)
 		return
 	}
 
-	sessionStore := sessions.Default(c)
-	uid := sessionStore.Get(userKey)
-	currentUser, _ := findUserByID(uid.(string))
+	var photos []photo
+	var next pageKey
+
+	if visible {
+		photos, next, err = st.Photos.ByUser(user.ID, start, pageSize(c))
+
+		if err != nil {
+			log.Errorf("Error: %v", err)
+			c.HTML(http.StatusOK, "404.html", nil)
+			return
+		}
+	}
 
 	c.HTML(http.StatusOK, "user.html", gin.H{
 		"user":        user,
 		"photos":      photos,
-		"IsSelf":      uid == user.ID,
-		"CurrentUser": currentUser,
+		"next":        encodeCursor(next),
+		"IsSelf":      currentUserID(c) == user.ID,
+		"IsHidden":    !visible,
+		"CurrentUser": currentUser(c),
 	})
 }
 
-func findUserByUsername(username string) (*user, error) {
-
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppUsers"),
-		Limit:     aws.Int64(1),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"Username": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(username),
-					},
-				},
-			},
-		},
-		IndexName: aws.String("Username-index"),
-	}
+// Follow inserts a record into the followers table
+func Follow(c *gin.Context) {
+	fid := c.Params.ByName("id")
 
-	qo, err := svc.Query(queryInput)
+	requested, err := followUser(storesFrom(c), fid, currentUserID(c))
 
 	if err != nil {
-		log.Errorf("FindUserByUsername failed: %v", err)
-		return nil, err
-	}
-
-	users := []user{}
-	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &users); err != nil {
-		log.Errorf("Failed to unmarshal Query result items, %v", err)
-		return nil, err
-	}
-
-	if len(users) == 0 {
-		// Returned no users
-		return nil, errors.New("User not found")
+		log.Errorf("failed to put follower record, %v", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
 	}
 
-	return &users[0], nil
+	c.JSON(http.StatusOK, gin.H{"requested": requested})
 }
 
-func findUserByID(id string) (*user, error) {
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppUsers"),
-		Limit:     aws.Int64(1),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"ID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(id),
-					},
-				},
-			},
-		},
-	}
+// Unfollow deletes a record from the followers table
+func Unfollow(c *gin.Context) {
+	fid := c.Params.ByName("id")
 
-	qo, err := svc.Query(queryInput)
+	err := unfollowUser(storesFrom(c), fid, currentUserID(c))
 
 	if err != nil {
-		return nil, err
+		log.Errorf("failed to delete follower record, %v", err)
+		c.JSON(http.StatusInternalServerError, nil)
+		return
 	}
 
-	users := []user{}
-	if err := dynamodbattribute.UnmarshalListOfMaps(qo.Items, &users); err != nil {
-		log.Errorf("Failed to unmarshal Query result items, %v", err)
-		return nil, err
-	}
+	c.JSON(http.StatusOK, nil)
+}
 
-	if len(users) == 0 {
-		// Returned no users
-		return nil, errors.New("User not found")
-	}
+// Followers lists the users following a user
+// GET /user/:username/followers
+func Followers(c *gin.Context) {
+	showFollowList(c, "Followers", followersPage)
+}
 
-	return &users[0], nil
+// Following lists the users a user follows
+// GET /user/:username/following
+func Following(c *gin.Context) {
+	showFollowList(c, "Following", followingPage)
 }
 
-func (u *user) PhotoCount() uint {
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppPhotos"),
-		Select:    aws.String("COUNT"),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"UserID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(u.ID),
-					},
-				},
-			},
-		},
-		IndexName: aws.String("UserID-index"),
-	}
+// followPage loads one page of a follow list of userid
+type followPage func(st *Stores, userid string, start pageKey, limit int) ([]user, pageKey, error)
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+func showFollowList(c *gin.Context, title string, page followPage) {
+	username := c.Params.ByName("username")
 
-	qo, err := svc.Query(queryInput)
+	st := storesFrom(c)
+
+	user, err := st.Users.FindByUsername(username)
 
 	if err != nil {
-		log.Errorf("Error getting photo count: %v", err)
-		return 0
+		log.Error("Error:", err)
+		c.HTML(http.StatusOK, "404.html", nil)
+		return
 	}
 
-	count := aws.Int64Value(qo.Count)
-
-	return uint(count)
-}
-
-// Follow inserts a record into the followers table
-func Follow(c *gin.Context) {
-	sessionStore := sessions.Default(c)
-	uid := sessionStore.Get(userKey)
-	fid := c.Params.ByName("id")
-
-	follower := &follower{
-		UserID:     fid,
-		FollowerID: uid.(string),
+	// The follows of private accounts are as hidden as their photos
+	if ok, err := canSeePhotos(st, currentUserID(c), user); !ok || err != nil {
+		c.HTML(http.StatusNotFound, "404.html", nil)
+		return
 	}
 
-	// Insert follower into DynamoDB
-
-	av, err := dynamodbattribute.MarshalMap(follower)
+	start, err := decodeCursor(c.Query("cursor"))
 
 	if err != nil {
-		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		c.HTML(http.StatusBadRequest, "404.html", nil)
+		return
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
-
-	_, err = svc.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("PhotosAppUsers"),
-		Item:      av,
-	})
+	users, next, err := page(st, user.ID, start, pageSize(c))
 
 	if err != nil {
-		log.Errorf("failed to put record to DynamoDB, %v", err)
-		c.JSON(http.StatusInternalServerError, nil)
+		log.Errorf("Error: %v", err)
+		c.HTML(http.StatusOK, "404.html", nil)
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.HTML(http.StatusOK, "follows.html", gin.H{
+		"title":       title,
+		"user":        user,
+		"users":       users,
+		"next":        encodeCursor(next),
+		"CurrentUser": currentUser(c),
+	})
 }
 
-// Unfollow deletes a record from the followers table
-func Unfollow(c *gin.Context) {
-	sessionStore := sessions.Default(c)
-	uid := sessionStore.Get(userKey)
-	fid := c.Params.ByName("id")
-
-	follower := &follower{
-		UserID:     fid,
-		FollowerID: uid.(string),
-	}
-
-	// Delete follower from DynamoDB
+// followersPage returns a page of the users following userid
+func followersPage(st *Stores, userid string, start pageKey, limit int) ([]user, pageKey, error) {
 
-	av, err := dynamodbattribute.MarshalMap(follower)
+	ids, next, err := st.Followers.FollowersPage(userid, start, limit)
 
 	if err != nil {
-		log.Errorf("failed to DynamoDB marshal Record, %v", err)
+		return nil, nil, err
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	users, err := st.Users.FindMany(ids)
 
-	_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: aws.String("PhotosAppUsers"),
-		Key:       av,
-	})
+	return users, next, err
+}
+
+// followingPage returns a page of the users userid follows
+func followingPage(st *Stores, userid string, start pageKey, limit int) ([]user, pageKey, error) {
+
+	ids, next, err := st.Followers.FollowingPage(userid, start, limit)
 
 	if err != nil {
-		log.Errorf("failed to delete record from DynamoDB, %v", err)
-		c.JSON(http.StatusInternalServerError, nil)
+		return nil, nil, err
 	}
 
-	c.JSON(http.StatusOK, nil)
-}
+	users, err := st.Users.FindMany(ids)
 
-// Followers returns the number of followers this user has
-func (u *user) Followers() uint {
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppFollowers"),
-		Select:    aws.String("COUNT"),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"UserID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(u.ID),
-					},
-				},
-			},
-		},
-	}
+	return users, next, err
+}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+// followUser records that followerid follows userid. Follows of a private
+// account become a pending request, which is reported by the result. Callers
+// check canFollow.
+func followUser(st *Stores, userid string, followerid string) (bool, error) {
 
-	qo, err := svc.Query(queryInput)
+	u, err := st.Users.FindByID(userid)
 
 	if err != nil {
-		log.Errorf("Error getting follower count: %v", err)
-		return 0
+		return false, err
 	}
 
-	count := aws.Int64Value(qo.Count)
+	if !u.Private {
+		return false, addFollower(st, userid, followerid)
+	}
 
-	return uint(count)
-}
+	following, err := st.Followers.Exists(userid, followerid)
 
-// Following returns the number of users this user is following
-func (u *user) Following() uint {
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppFollowers"),
-		Select:    aws.String("COUNT"),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"FollowerID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(u.ID),
-					},
-				},
-			},
-		},
-		IndexName: aws.String("FollowerID-index"),
+	if err != nil || following {
+		return false, err
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	return true, st.Requests.Put(&followRequest{
+		UserID:     userid,
+		FollowerID: followerid,
+		CreatedAt:  time.Now(),
+	})
+}
 
-	qo, err := svc.Query(queryInput)
+// addFollower records the follow and copies recent photos to the timeline
+func addFollower(st *Stores, userid string, followerid string) error {
+
+	err := st.Followers.Put(&follower{
+		UserID:     userid,
+		FollowerID: followerid,
+	})
+
+	if err == errExists {
+		return nil
+	}
 
 	if err != nil {
-		log.Errorf("Error getting following count: %v", err)
-		return 0
+		return err
 	}
 
-	count := aws.Int64Value(qo.Count)
+	backfillTimeline(st, userid, followerid)
 
-	return uint(count)
+	return nil
 }
 
-// Follows returns true if the user (u) follows the userid
-func (u *user) Follows(userid string) bool {
-
-	queryInput := &dynamodb.QueryInput{
-		TableName: aws.String("PhotosAppFollowers"),
-		Select:    aws.String("COUNT"),
-
-		KeyConditions: map[string]*dynamodb.Condition{
-			"FollowerID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(u.ID),
-					},
-				},
-			},
-			"UserID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(userid),
-					},
-				},
-			},
-		},
+// unfollowUser removes the follow record or pending request of followerid
+// for userid
+func unfollowUser(st *Stores, userid string, followerid string) error {
+
+	if err := st.Requests.Delete(userid, followerid); err != nil && err != errNotFound {
+		return err
 	}
 
-	sess := session.Must(session.NewSession())
-	svc := dynamodb.New(sess)
+	err := st.Followers.Delete(&follower{
+		UserID:     userid,
+		FollowerID: followerid,
+	})
 
-	qo, err := svc.Query(queryInput)
+	if err == errNotFound {
+		return nil
+	}
 
 	if err != nil {
-		log.Errorf("Error getting follows count: %v", err)
-		return false
+		return err
 	}
 
-	count := aws.Int64Value(qo.Count)
+	pruneTimeline(st, userid, followerid)
 
-	return count > 0
+	return nil
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nfnt/resize"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/zoharngo/insta.git/objectstore"
+	"github.com/zoharngo/insta.git/video"
+)
+
+// Videos are stored like images, with their codec and duration on the media
+// item. Their thumbnail is a JPEG poster frame made in the web process, as
+// the Lambda function only handles images.
+
+// videoItem is the Type of video media items
+const videoItem = "video"
+
+var (
+	frameExtractorOnce sync.Once
+	frameExtractor     video.FrameExtractor
+)
+
+// frames returns the extractor named by 'video.frameExtractor': "ffmpeg" runs
+// 'video.ffmpegPath', "placeholder" renders blank posters
+func frames() video.FrameExtractor {
+
+	frameExtractorOnce.Do(func() {
+		name := viper.GetString("video.frameExtractor")
+
+		log.Info("Frame extractor: ", name)
+
+		blank := video.Placeholder{Width: int(thumbnailSize), Height: int(thumbnailSize) * 9 / 16}
+
+		if name == "placeholder" {
+			frameExtractor = blank
+			return
+		}
+
+		path := viper.GetString("video.ffmpegPath")
+		if path == "" {
+			path = "ffmpeg"
+		}
+
+		ffmpeg, err := video.NewFFmpeg(path)
+
+		if err != nil {
+			log.Errorf("Could not find ffmpeg, using blank posters: %v", err)
+			frameExtractor = blank
+			return
+		}
+
+		frameExtractor = ffmpeg
+	})
+
+	return frameExtractor
+}
+
+// maxVideoDuration is the longest video accepted, a minute unless
+// 'video.maxDuration' says otherwise
+func maxVideoDuration() time.Duration {
+
+	max := viper.GetDuration("video.maxDuration")
+	if max <= 0 {
+		max = time.Minute
+	}
+
+	return max
+}
+
+// probeVideo checks the container, codec and length of an uploaded video.
+// Rejections are uploadErrors.
+func probeVideo(file multipart.File, fh *multipart.FileHeader) (*video.Info, error) {
+
+	info, err := video.Probe(file, fh.Size)
+
+	if err == video.ErrUnsupported {
+		return nil, rejectUpload(http.StatusUnsupportedMediaType, fh.Filename, "only MP4 and WebM videos in H.264, HEVC, VP8, VP9 or AV1 are supported")
+	}
+
+	if err == video.ErrMalformed {
+		return nil, rejectUpload(http.StatusUnprocessableEntity, fh.Filename, "the video is damaged")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Duration <= 0 {
+		return nil, rejectUpload(http.StatusUnprocessableEntity, fh.Filename, "the length of the video is unknown")
+	}
+
+	if max := maxVideoDuration(); info.Duration > max {
+		return nil, rejectUpload(http.StatusUnprocessableEntity, fh.Filename, "videos can be at most %s long", max)
+	}
+
+	return info, nil
+}
+
+// generatePoster stores a frame of the video item, scaled to maxWidth, as its
+// thumbnail
+func generatePoster(objects objectstore.ObjectStore, item mediaItem, maxWidth uint) error {
+
+	log.Infof("Fetching %v", item.Key())
+
+	body, err := objects.Get(item.Key())
+
+	if err != nil {
+		log.Errorf("Could not download original: %v", err)
+		return err
+	}
+
+	defer body.Close()
+
+	// A second in skips fades from black, unless the video is shorter
+	at := time.Second
+	if item.Duration < 2*at {
+		at = item.Duration / 2
+	}
+
+	log.Infof("Extracting frame at %s", at)
+
+	frame, err := frames().Frame(body, at)
+
+	if err != nil {
+		log.Errorf("Could not extract frame: %v", err)
+		return err
+	}
+
+	poster := resize.Thumbnail(maxWidth, maxWidth, frame, resize.Lanczos3)
+
+	buf := new(bytes.Buffer)
+
+	if err := jpeg.Encode(buf, poster, nil); err != nil {
+		log.Errorf("JPEG encoding error: %v", err)
+		return err
+	}
+
+	if err := objects.Put(item.ThumbKey(), buf, "image/jpeg"); err != nil {
+		log.Error("Failed to upload", err)
+		return err
+	}
+
+	log.Println("Successfully uploaded to", objects.URL(item.ThumbKey()))
+
+	return nil
+}
+
+// IsVideo reports whether the item is a video rather than an image
+func (m mediaItem) IsVideo() bool {
+	return m.Type == videoItem
+}
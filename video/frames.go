@@ -0,0 +1,101 @@
+package video
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// FrameExtractor renders still frames of videos, used as their posters.
+type FrameExtractor interface {
+	// Frame decodes the frame shown at the given offset from the start.
+	Frame(video io.Reader, at time.Duration) (image.Image, error)
+}
+
+// FFmpeg extracts frames with the ffmpeg command line tool.
+type FFmpeg struct {
+	path string
+}
+
+// NewFFmpeg returns an extractor running the ffmpeg binary at path, looked up
+// in PATH unless it contains a separator.
+func NewFFmpeg(path string) (*FFmpeg, error) {
+
+	path, err := exec.LookPath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FFmpeg{path: path}, nil
+}
+
+// Frame implements FrameExtractor. The video is copied to a temporary file
+// since MP4 files often keep their index at the end, out of reach of a pipe.
+func (f *FFmpeg) Frame(video io.Reader, at time.Duration) (image.Image, error) {
+
+	tmp, err := ioutil.TempFile("", "video-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, video)
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var out, stderr bytes.Buffer
+
+	cmd := exec.Command(f.path,
+		"-v", "error",
+		"-ss", fmt.Sprintf("%.3f", at.Seconds()),
+		"-i", tmp.Name(),
+		"-frames:v", "1",
+		"-f", "image2pipe",
+		"-vcodec", "png",
+		"-")
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if out.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg: no frame at %s", at)
+	}
+
+	return png.Decode(&out)
+}
+
+// Placeholder renders a plain frame for every video, for setups without
+// ffmpeg.
+type Placeholder struct {
+	Width, Height int
+}
+
+// Frame implements FrameExtractor.
+func (p Placeholder) Frame(video io.Reader, at time.Duration) (image.Image, error) {
+
+	img := image.NewRGBA(image.Rect(0, 0, p.Width, p.Height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0x26, 0x26, 0x26, 0xFF}), image.Point{}, draw.Src)
+
+	return img, nil
+}
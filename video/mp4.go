@@ -0,0 +1,166 @@
+package video
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// mp4Containers are the boxes walked on the way to the track metadata.
+var mp4Containers = map[string]bool{
+	"moov": true,
+	"trak": true,
+	"mdia": true,
+	"minf": true,
+	"stbl": true,
+}
+
+// maxMP4Depth caps the nesting of container boxes. Real files need five
+// levels, deeper ones are crafted to exhaust the stack.
+const maxMP4Depth = 8
+
+// probeMP4 reads the movie header for the duration and the sample
+// description of the first video track for the codec.
+func probeMP4(r io.ReaderAt, size int64) (*Info, error) {
+
+	info := &Info{Container: "mp4", ContentType: "video/mp4"}
+
+	var brand [4]byte
+
+	if _, err := r.ReadAt(brand[:], 8); err != nil {
+		return nil, err
+	}
+
+	// QuickTime files share the box structure but browsers do not play them
+	if string(brand[:]) == "qt  " {
+		return nil, ErrUnsupported
+	}
+
+	var track struct{ handler, codec string }
+
+	var walk func(off, end int64, depth int) error
+
+	walk = func(off, end int64, depth int) error {
+		if depth > maxMP4Depth {
+			return ErrMalformed
+		}
+
+		return readBoxes(r, off, end, func(typ string, off, end int64) error {
+
+			switch {
+			case mp4Containers[typ]:
+				if typ == "trak" {
+					track.handler, track.codec = "", ""
+				}
+
+				if err := walk(off, end, depth+1); err != nil {
+					return err
+				}
+
+				if typ == "trak" && track.handler == "vide" && info.Codec == "" && mp4Codecs[track.codec] {
+					info.Codec = track.codec
+				}
+
+			case typ == "mvhd":
+				d, err := readMovieDuration(r, off)
+				if err != nil {
+					return err
+				}
+				info.Duration = d
+
+			case typ == "hdlr":
+				// version and flags, pre_defined, handler_type
+				var b [4]byte
+				if _, err := r.ReadAt(b[:], off+8); err != nil {
+					return err
+				}
+				track.handler = string(b[:])
+
+			case typ == "stsd":
+				// version and flags, entry_count, then the first entry's box header
+				var b [16]byte
+				if _, err := r.ReadAt(b[:], off); err != nil {
+					return err
+				}
+				if binary.BigEndian.Uint32(b[4:8]) > 0 {
+					track.codec = string(b[12:16])
+				}
+			}
+
+			return nil
+		})
+	}
+
+	if err := walk(0, size, 0); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// readBoxes calls fn with the type and payload bounds of every box between
+// off and end.
+func readBoxes(r io.ReaderAt, off, end int64, fn func(typ string, off, end int64) error) error {
+
+	for off+8 <= end {
+		var hdr [16]byte
+
+		if _, err := r.ReadAt(hdr[:8], off); err != nil {
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		header := int64(8)
+
+		switch size {
+		case 0: // extends to the end of the file
+			size = end - off
+		case 1: // 64 bit size follows the type
+			if _, err := r.ReadAt(hdr[8:16], off+8); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			header = 16
+		}
+
+		if size < header || size > end-off {
+			return ErrMalformed
+		}
+
+		if err := fn(typ, off+header, off+size); err != nil {
+			return err
+		}
+
+		off += size
+	}
+
+	return nil
+}
+
+// readMovieDuration decodes the duration of an mvhd box starting at off
+func readMovieDuration(r io.ReaderAt, off int64) (time.Duration, error) {
+
+	var b [32]byte
+
+	if _, err := r.ReadAt(b[:], off); err != nil {
+		return 0, err
+	}
+
+	var timescale, duration uint64
+
+	if b[0] == 1 {
+		// version, flags, 64 bit creation and modification times
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+
+	if timescale == 0 {
+		return 0, ErrMalformed
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
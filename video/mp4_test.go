@@ -0,0 +1,88 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// box returns an MP4 box of the given type around the payloads
+func box(typ string, payloads ...[]byte) []byte {
+
+	body := bytes.Join(payloads, nil)
+
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+
+	return append(b, body...)
+}
+
+// testMP4 returns a file with one video track of the codec lasting 12.5s
+func testMP4(codec string) []byte {
+
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 12500)
+
+	hdlr := make([]byte, 12)
+	copy(hdlr[8:], "vide")
+
+	stsd := make([]byte, 8)
+	binary.BigEndian.PutUint32(stsd[4:], 1)
+
+	stbl := box("stbl", box("stsd", stsd, box(codec, make([]byte, 8))))
+	trak := box("trak", box("mdia", box("hdlr", hdlr), box("minf", stbl)))
+
+	return append(box("ftyp", []byte("isom"), make([]byte, 4)), box("moov", box("mvhd", mvhd), trak)...)
+}
+
+func TestProbeMP4(t *testing.T) {
+
+	file := testMP4("avc1")
+
+	info, err := Probe(bytes.NewReader(file), int64(len(file)))
+
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+
+	if info.Codec != "avc1" || info.Duration != 12500*time.Millisecond {
+		t.Errorf("Probe() = %+v, want avc1 lasting 12.5s", info)
+	}
+}
+
+func TestProbeMP4Nesting(t *testing.T) {
+
+	// Deeply nested boxes used to overflow the stack of the recursive walk
+
+	const depth = 1 << 20
+
+	file := box("ftyp", []byte("isom"), make([]byte, 4))
+	moov := make([]byte, 0, 8*depth)
+
+	for i := 0; i < depth; i++ {
+		var hdr [8]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(8*(depth-i)))
+		copy(hdr[4:], "moov")
+		moov = append(moov, hdr[:]...)
+	}
+
+	file = append(file, moov...)
+
+	if _, err := Probe(bytes.NewReader(file), int64(len(file))); err != ErrMalformed {
+		t.Errorf("Probe() error = %v, want ErrMalformed", err)
+	}
+}
+
+func TestSniff(t *testing.T) {
+
+	for brand, want := range map[string]bool{"isom": true, "mp42": true, "qt  ": true, "heic": false, "heim": false, "heis": false, "mif1": false, "avif": false} {
+		head := box("ftyp", []byte(brand), make([]byte, 4))
+
+		if got := Sniff(head); got != want {
+			t.Errorf("Sniff() of brand %q = %v, want %v", brand, got, want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package video inspects uploaded videos and renders their poster frames.
+// Containers are parsed in pure Go so uploads can be checked without any
+// external tools; frames need a FrameExtractor.
+package video
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/zoharngo/insta.git/imaging"
+)
+
+// ErrUnsupported is returned for files that are not MP4 or WebM videos with
+// a codec browsers play.
+var ErrUnsupported = errors.New("Unsupported video format")
+
+// ErrMalformed is returned when the container structure is broken.
+var ErrMalformed = errors.New("Malformed video file")
+
+// Info describes a video.
+type Info struct {
+	Container   string // "mp4" or "webm"
+	ContentType string // MIME type of the container
+	Codec       string // video codec, e.g. "avc1" or "vp9"
+	Duration    time.Duration
+}
+
+// mp4Codecs are the sample entry types accepted in MP4 files.
+var mp4Codecs = map[string]bool{
+	"avc1": true,
+	"avc3": true,
+	"hvc1": true,
+	"hev1": true,
+	"av01": true,
+	"vp09": true,
+}
+
+// webmCodecs maps the codec IDs accepted in WebM files to their short names.
+var webmCodecs = map[string]string{
+	"V_VP8": "vp8",
+	"V_VP9": "vp9",
+	"V_AV1": "av1",
+}
+
+// Sniff reports whether the first bytes of a file look like an MP4,
+// QuickTime or Matroska container. Probe tells which of them are supported.
+func Sniff(head []byte) bool {
+
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		return !imaging.IsImageBrand(string(head[8:12]))
+	}
+
+	return len(head) >= 4 && head[0] == 0x1A && head[1] == 0x45 && head[2] == 0xDF && head[3] == 0xA3
+}
+
+// Probe sniffs the container and video codec of the size bytes in r and
+// reads the duration. Returns ErrUnsupported for anything but MP4 and WebM
+// with a supported codec.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+
+	var magic [8]byte
+
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+
+	var info *Info
+	var err error
+
+	switch {
+	case string(magic[4:8]) == "ftyp":
+		info, err = probeMP4(r, size)
+	case magic[0] == 0x1A && magic[1] == 0x45 && magic[2] == 0xDF && magic[3] == 0xA3:
+		info, err = probeWebM(r, size)
+	default:
+		return nil, ErrUnsupported
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrMalformed
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Codec == "" {
+		return nil, ErrUnsupported
+	}
+
+	return info, nil
+}
@@ -0,0 +1,277 @@
+package video
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// EBML element IDs, with their length markers as in the specification
+const (
+	ebmlHeader    = 0x1A45DFA3
+	ebmlDocType   = 0x4282
+	mkvSegment    = 0x18538067
+	mkvInfo       = 0x1549A966
+	mkvTimescale  = 0x2AD7B1
+	mkvDuration   = 0x4489
+	mkvTracks     = 0x1654AE6B
+	mkvTrackEntry = 0xAE
+	mkvTrackType  = 0x83
+	mkvCodecID    = 0x86
+	mkvCluster    = 0x1F43B675
+)
+
+// mkvVideoTrack is the TrackType of video tracks
+const mkvVideoTrack = 1
+
+// probeWebM reads the segment info for the duration and the tracks for the
+// codec of the first video track.
+func probeWebM(r io.ReaderAt, size int64) (*Info, error) {
+
+	info := &Info{Container: "webm", ContentType: "video/webm"}
+
+	var doctype string
+	var timescale uint64 = 1000000 // nanoseconds per tick unless the file says otherwise
+	var duration float64
+	var haveInfo, haveTracks bool
+
+	err := readElements(r, 0, size, func(id uint64, off, end int64) (bool, error) {
+
+		switch id {
+		case ebmlHeader:
+			return false, readElements(r, off, end, func(id uint64, off, end int64) (bool, error) {
+				if id == ebmlDocType {
+					s, err := readString(r, off, end)
+					doctype = s
+					return true, err
+				}
+				return false, nil
+			})
+
+		case mkvSegment:
+			if doctype != "webm" {
+				return true, ErrUnsupported
+			}
+
+			return true, readElements(r, off, end, func(id uint64, off, end int64) (bool, error) {
+
+				switch id {
+				case mkvInfo:
+					haveInfo = true
+					return haveTracks, readElements(r, off, end, func(id uint64, off, end int64) (bool, error) {
+						var err error
+						switch id {
+						case mkvTimescale:
+							timescale, err = readUint(r, off, end)
+						case mkvDuration:
+							duration, err = readFloat(r, off, end)
+						}
+						return false, err
+					})
+
+				case mkvTracks:
+					haveTracks = true
+					return haveInfo, readElements(r, off, end, func(id uint64, off, end int64) (bool, error) {
+						if id != mkvTrackEntry {
+							return false, nil
+						}
+
+						codec, err := readVideoCodec(r, off, end)
+						if codec != "" && info.Codec == "" {
+							info.Codec = codec
+						}
+						return false, err
+					})
+
+				case mkvCluster:
+					// Media data follows, the metadata comes before it
+					return true, nil
+				}
+
+				return false, nil
+			})
+		}
+
+		return false, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if doctype != "webm" {
+		return nil, ErrUnsupported
+	}
+
+	info.Duration = time.Duration(duration * float64(timescale))
+
+	return info, nil
+}
+
+// readVideoCodec returns the short codec name of a video TrackEntry, or ""
+// for other tracks and unsupported codecs
+func readVideoCodec(r io.ReaderAt, off, end int64) (string, error) {
+
+	var kind uint64
+	var codecID string
+
+	err := readElements(r, off, end, func(id uint64, off, end int64) (bool, error) {
+		var err error
+		switch id {
+		case mkvTrackType:
+			kind, err = readUint(r, off, end)
+		case mkvCodecID:
+			codecID, err = readString(r, off, end)
+		}
+		return false, err
+	})
+
+	if err != nil || kind != mkvVideoTrack {
+		return "", err
+	}
+
+	return webmCodecs[codecID], nil
+}
+
+// readElements calls fn with the ID and data bounds of every element between
+// off and end until fn asks to stop. Elements of unknown size, as written by
+// live encoders, extend to end.
+func readElements(r io.ReaderAt, off, end int64, fn func(id uint64, off, end int64) (bool, error)) error {
+
+	for off < end {
+		id, n, _, err := readVint(r, off, true)
+		if err != nil {
+			return err
+		}
+		off += int64(n)
+
+		size, n, unknown, err := readVint(r, off, false)
+		if err != nil {
+			return err
+		}
+		off += int64(n)
+
+		next := end
+		if !unknown {
+			if size > uint64(end-off) {
+				return ErrMalformed
+			}
+			next = off + int64(size)
+		}
+
+		stop, err := fn(id, off, next)
+		if err != nil || stop {
+			return err
+		}
+
+		if unknown {
+			return nil
+		}
+
+		off = next
+	}
+
+	return nil
+}
+
+// readVint reads an EBML variable length integer. IDs keep their length
+// marker bit, sizes drop it; unknown reports the reserved all ones size.
+func readVint(r io.ReaderAt, off int64, id bool) (val uint64, n int, unknown bool, err error) {
+
+	var b [8]byte
+
+	if _, err = r.ReadAt(b[:1], off); err != nil {
+		return
+	}
+
+	n = 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		if n++; n > 8 {
+			return 0, 0, false, ErrMalformed
+		}
+	}
+
+	if n > 1 {
+		if _, err = r.ReadAt(b[1:n], off+1); err != nil {
+			return
+		}
+	}
+
+	val = uint64(b[0])
+	if !id {
+		val &= uint64(0xFF >> uint(n))
+	}
+
+	for i := 1; i < n; i++ {
+		val = val<<8 | uint64(b[i])
+	}
+
+	unknown = !id && val == 1<<uint(7*n)-1
+
+	return
+}
+
+func readData(r io.ReaderAt, off, end int64, max int64) ([]byte, error) {
+
+	if end-off > max {
+		return nil, ErrMalformed
+	}
+
+	b := make([]byte, end-off)
+
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func readUint(r io.ReaderAt, off, end int64) (uint64, error) {
+
+	b, err := readData(r, off, end, 8)
+	if err != nil {
+		return 0, err
+	}
+
+	var val uint64
+	for _, c := range b {
+		val = val<<8 | uint64(c)
+	}
+
+	return val, nil
+}
+
+func readFloat(r io.ReaderAt, off, end int64) (float64, error) {
+
+	b, err := readData(r, off, end, 8)
+	if err != nil {
+		return 0, err
+	}
+
+	switch len(b) {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+
+	return 0, ErrMalformed
+}
+
+func readString(r io.ReaderAt, off, end int64) (string, error) {
+
+	b, err := readData(r, off, end, 256)
+	if err != nil {
+		return "", err
+	}
+
+	// Strings may be padded with zeros
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+
+	return string(b), nil
+}